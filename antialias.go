@@ -0,0 +1,57 @@
+package gosvg
+
+import "strings"
+
+// Antialiasing selects how the edges of the shapes are smoothed.
+type Antialiasing uint8
+
+const (
+	// AntialiasAuto follows the shape-rendering property of each shape:
+	// "crispEdges" and "optimizeSpeed" select AntialiasNone, the other
+	// values AntialiasStandard.
+	// The text follows the property of its <text> element.
+	AntialiasAuto Antialiasing = iota
+	// AntialiasNone turns each pixel either on or off, according
+	// to its center, which is suited to pixel art.
+	AntialiasNone
+	// AntialiasStandard uses the exact area of each pixel covered by a shape.
+	AntialiasStandard
+	// AntialiasSupersample estimates the area covered with a regular grid
+	// of samples in each pixel (see Options.Samples).
+	// It is slower, but contrary to AntialiasStandard, correctly handles
+	// overlapping sub-paths.
+	AntialiasSupersample
+)
+
+const (
+	defaultSamples = 4
+	maxSamples     = 16
+)
+
+// samples returns the value of `cellScanner.samples` for `aa`,
+// given Options.Samples. AntialiasAuto is handled as AntialiasStandard,
+// until the shape-rendering property is read (see state.SetShapeRendering).
+func (aa Antialiasing) samples(supersamples int) int {
+	switch aa {
+	case AntialiasNone:
+		return 1
+	case AntialiasSupersample:
+		if supersamples <= 0 {
+			return defaultSamples
+		} else if supersamples > maxSamples {
+			return maxSamples
+		}
+		return supersamples
+	default:
+		return 0
+	}
+}
+
+// shapeRendering returns the anti-aliasing mode required by
+// the given value of the shape-rendering property
+func shapeRendering(value string) Antialiasing {
+	if strings.EqualFold(value, "crispEdges") || strings.EqualFold(value, "optimizeSpeed") {
+		return AntialiasNone
+	}
+	return AntialiasStandard
+}
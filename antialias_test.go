@@ -0,0 +1,104 @@
+package gosvg
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestShapeRendering(t *testing.T) {
+	tests := []struct {
+		root string
+		exp  Antialiasing
+	}{
+		{`<svg>`, AntialiasStandard},
+		{`<svg shape-rendering="crispEdges">`, AntialiasNone},
+		{`<svg shape-rendering="optimizeSpeed">`, AntialiasNone},
+		{`<svg shape-rendering="geometricPrecision">`, AntialiasStandard},
+		{`<svg style="fill: red; shape-rendering: crispedges">`, AntialiasNone},
+		{`<svg style="shape-rendering:auto" shape-rendering="crispEdges">`, AntialiasStandard},
+		{`<?xml version="1.0"?><!-- comment --><svg shape-rendering="crispEdges">`, AntialiasNone},
+	}
+	for _, tt := range tests {
+		root := rootProperties(t, tt.root+`<rect shape-rendering="auto"/></svg>`)
+		if got := shapeRendering(root["shape-rendering"]); got != tt.exp {
+			t.Fatalf("%s: expected %d, got %d", tt.root, tt.exp, got)
+		}
+	}
+}
+
+// returns the number of partially covered pixels
+func countAntialiased(img *image.RGBA) int {
+	count := 0
+	for i := 3; i < len(img.Pix); i += 4 {
+		if a := img.Pix[i]; a != 0 && a != 0xff {
+			count++
+		}
+	}
+	return count
+}
+
+func TestAntialiasing(t *testing.T) {
+	circle := `<circle cx="300" cy="300" r="123.4" fill="black" />`
+	crisp := strings.Replace(fmt.Sprintf(template, circle), "<svg", `<svg shape-rendering="crispEdges"`, 1)
+	tests := []struct {
+		input   string
+		aa      Antialiasing
+		aliased bool
+	}{
+		{fmt.Sprintf(template, circle), AntialiasAuto, false},
+		{fmt.Sprintf(template, circle), AntialiasNone, true},
+		{fmt.Sprintf(template, circle), AntialiasSupersample, false},
+		{crisp, AntialiasAuto, true},
+		{crisp, AntialiasStandard, false},
+	}
+	for i, tt := range tests {
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(tt.input), &Options{Antialiasing: tt.aa})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count := countAntialiased(img.(*image.RGBA)); (count == 0) != tt.aliased {
+			t.Fatalf("test %d: unexpected number of anti-aliased pixels %d", i, count)
+		}
+	}
+}
+
+func TestShapeRenderingElements(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="300" height="100">
+	<style>.crisp { shape-rendering: crispEdges }</style>
+	<g shape-rendering="crispEdges">
+		<circle cx="50" cy="50" r="40.3"/>
+		<circle cx="150" cy="50" r="40.3" style="shape-rendering: geometricPrecision"/>
+	</g>
+	<circle class="crisp" cx="250" cy="50" r="40.3"/>
+	</svg>`
+	for _, tt := range []struct {
+		aa      Antialiasing
+		aliased [3]bool // for each circle
+	}{
+		{AntialiasAuto, [3]bool{true, false, true}},
+		{AntialiasStandard, [3]bool{false, false, false}},
+		{AntialiasNone, [3]bool{true, true, true}},
+	} {
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &Options{Antialiasing: tt.aa})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var counts [3]int // anti-aliased pixels
+		rgba := img.(*image.RGBA)
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 300; x++ {
+				if a := rgba.RGBAAt(x, y).A; a != 0 && a != 0xff {
+					counts[x/100]++
+				}
+			}
+		}
+		for i, count := range counts {
+			if (count == 0) != tt.aliased[i] {
+				t.Fatalf("%d: unexpected anti-aliasing %v", tt.aa, counts)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package gosvg
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// BatchItem is one image rendered by RenderBatch.
+type BatchItem struct {
+	// Src is read when the item is rendered.
+	Src io.Reader
+	// Options may be nil to use the default options.
+	Options *Options
+}
+
+// BatchOptions controls the concurrency of RenderBatch.
+type BatchOptions struct {
+	// Workers is the maximum number of images rendered
+	// at the same time. It defaults to runtime.GOMAXPROCS(0).
+	Workers int
+	// MemoryBudget, if positive, is the memory, in bytes, of the output
+	// images and layers of the items being rendered at the same time.
+	// An item only starts when its output fits in the budget
+	// left by the others, so that the layers may exceed it.
+	// An item whose output exceeds the whole budget is rendered alone.
+	MemoryBudget int64
+}
+
+// BatchResult is the outcome of the rendering of one item.
+type BatchResult struct {
+	Index    int // of the item in the list given to RenderBatch
+	Image    image.Image
+	Warnings []Warning
+	Err      error
+}
+
+// RenderBatch renders `items` concurrently, as RenderWithWarnings does,
+// and calls `handle` with each result, in completion order.
+// `handle` is never called concurrently.
+// If `ctx` is cancelled, the remaining items are not rendered,
+// and their result contains the error.
+// RenderBatch returns once `handle` has been called for every item.
+func RenderBatch(ctx context.Context, items []BatchItem, opts BatchOptions, handle func(BatchResult)) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var budget *memoryBudget
+	if opts.MemoryBudget > 0 {
+		budget = newMemoryBudget(opts.MemoryBudget)
+	}
+
+	indices := make(chan int)
+	results := make(chan BatchResult, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				item := items[i]
+				res := BatchResult{Index: i}
+				if err := ctx.Err(); err != nil {
+					res.Err = fmt.Errorf("gosvg: rendering aborted: %w", err)
+				} else {
+					res.Image, res.Warnings, res.Err = render(ctx, item.Src, item.Options, budget)
+				}
+				results <- res
+			}
+		}()
+	}
+	go func() {
+		for i := range items {
+			indices <- i
+		}
+		close(indices)
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		handle(res)
+	}
+}
+
+// memoryBudget is shared by the sessions of a batch.
+// A nil budget is valid, and means no limit.
+type memoryBudget struct {
+	max int64
+
+	mu      sync.Mutex
+	used    int64
+	changed chan struct{} // closed when `used` decreases
+}
+
+func newMemoryBudget(max int64) *memoryBudget {
+	return &memoryBudget{max: max, changed: make(chan struct{})}
+}
+
+// acquire waits until `size` bytes fit in the budget, or until
+// nothing else uses it.
+func (m *memoryBudget) acquire(ctx context.Context, size int64) error {
+	if m == nil {
+		return nil
+	}
+	for {
+		m.mu.Lock()
+		if m.used == 0 || m.used+size <= m.max {
+			m.used += size
+			m.mu.Unlock()
+			return nil
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gosvg: rendering aborted: %w", ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+// add records `size` bytes, which may be negative, without waiting.
+func (m *memoryBudget) add(size int64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.used += size
+	if size < 0 {
+		close(m.changed)
+		m.changed = make(chan struct{})
+	}
+}
+
+// release must be called when the memory returned by `acquire`
+// is not used anymore
+func (m *memoryBudget) release(size int64) { m.add(-size) }
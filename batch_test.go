@@ -0,0 +1,124 @@
+package gosvg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRenderBatch(t *testing.T) {
+	files, err := filepath.Glob("testdata/sportsIcons/*.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		contents [][]byte
+		items    []BatchItem
+	)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, content)
+		items = append(items, BatchItem{Src: bytes.NewReader(content)})
+	}
+	// an invalid item does not stop the batch
+	items = append(items, BatchItem{Src: bytes.NewReader([]byte("<svg")), Options: &Options{Strict: true}})
+
+	seen := make([]bool, len(items))
+	// a budget of about one image
+	RenderBatch(context.Background(), items, BatchOptions{Workers: 4, MemoryBudget: 4 * 600 * 600}, func(res BatchResult) {
+		if seen[res.Index] {
+			t.Fatalf("item %d handled twice", res.Index)
+		}
+		seen[res.Index] = true
+		if res.Index == len(contents) {
+			if res.Err == nil {
+				t.Fatal("expected an error for an invalid item")
+			}
+			return
+		}
+		if res.Err != nil {
+			t.Fatalf("%s: %s", files[res.Index], res.Err)
+		}
+		exp, err := Render(bytes.NewReader(contents[res.Index]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, res.Image, exp)
+	})
+	for i, ok := range seen {
+		if !ok {
+			t.Fatalf("item %d not handled", i)
+		}
+	}
+}
+
+func TestRenderBatchCancel(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/landscapeIcons/beach.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]BatchItem, 10)
+	for i := range items {
+		items[i].Src = bytes.NewReader(content)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var count int
+	RenderBatch(ctx, items, BatchOptions{Workers: 2}, func(res BatchResult) {
+		count++
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Fatalf("unexpected error %v", res.Err)
+		}
+	})
+	if count != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), count)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	m := newMemoryBudget(100)
+	ctx := context.Background()
+	// an item bigger than the budget is accepted when nothing else runs
+	if err := m.acquire(ctx, 150); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		if err := m.acquire(ctx, 60); err != nil {
+			t.Error(err)
+		}
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquire should wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	m.release(150)
+	<-acquired
+
+	m.add(30) // layers never wait
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := m.acquire(timeout, 20); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	m.release(90)
+	if m.used != 0 {
+		t.Fatalf("unexpected memory used %d", m.used)
+	}
+
+	var nilBudget *memoryBudget
+	if err := nilBudget.acquire(ctx, 1000); err != nil {
+		t.Fatal(err)
+	}
+	nilBudget.release(1000)
+}
@@ -1,21 +1,20 @@
 package gosvg
 
 import (
-	"bytes"
 	"fmt"
 	"image"
 	"image/color"
-	"image/png"
-	"io/ioutil"
-	"log"
+	"image/draw"
+	_ "image/gif" // register the formats supported by DrawRasterImage
+	_ "image/jpeg"
 	"math"
-	"os"
 
-	"github.com/benoitkugler/textlayout/pango"
 	"github.com/benoitkugler/webrender/backend"
 	"github.com/benoitkugler/webrender/css/parser"
 	"github.com/benoitkugler/webrender/matrix"
 	"github.com/srwiley/rasterx"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
 	"golang.org/x/image/math/fixed"
 )
 
@@ -49,8 +48,9 @@ func (c funcColor) toRasterxColor() interface{} {
 
 // argument for the rasterx.SetStroke function
 type strokeOptions struct {
-	lineCap rasterx.CapFunc
-	// lineGap     rasterx.GapFunc // not supported by webrender
+	leadingCap  rasterx.CapFunc
+	trailingCap rasterx.CapFunc
+	lineGap     rasterx.GapFunc
 	miterLimit  fixed.Int26_6
 	strokeWidth fixed.Int26_6
 	lineJoin    rasterx.JoinMode
@@ -58,9 +58,11 @@ type strokeOptions struct {
 
 var (
 	joinToFunc = [...]rasterx.JoinMode{
-		backend.Round: rasterx.Round,
-		backend.Bevel: rasterx.Bevel,
-		backend.Miter: rasterx.Miter,
+		backend.Round:     rasterx.Round,
+		backend.Bevel:     rasterx.Bevel,
+		backend.Miter:     rasterx.Miter,
+		backend.MiterClip: rasterx.MiterClip,
+		backend.Arcs:      rasterx.Arc,
 	}
 
 	capToFunc = [...]rasterx.CapFunc{
@@ -71,47 +73,90 @@ var (
 )
 
 // graphic state
-// to correctly handle opacity mask, each state must
-// have its own target image, which is merged into the main output
-// when closing the state.
+// The states created by `OnNewStack` draw into the target of their
+// parent, unless they are isolated (see `state.SetIsolation`): to correctly
+// handle opacity mask, they then have their own layer, which is merged
+// into their parent when closing the state.
+// To save memory, a layer is only allocated when something is drawn
+// into it, and only covers the pixels actually modified.
 type state struct {
 	stroker *rasterx.Dasher
 	filler  *rasterx.Filler
+	// lazily created for the evenodd fills,
+	// which RasterizerGV does not support (see `Canvas.fillerFor`)
+	evenOddFiller *rasterx.Filler
 
 	strokeOptions strokeOptions
-	dashes        []fixed.Int26_6
-	dashOffset    fixed.Int26_6
+	dashes        []float64 // in device space
+	dashOffset    float64
+
+	mat              matrix.Transform
+	nonScalingStroke bool        // see Options.NonScalingStroke and state.SetVectorEffect
+	strokeStyle      strokeStyle // see Options.Stroke
+	colorSpace       ColorSpace  // see Options.ColorSpace
+	session          *session    // receives the warnings
+	elementID        string      // reported by the warnings, see SetElementID
+
+	bounds  image.Rectangle // of the scanners
+	samples int             // see cellScanner.samples
 
-	mat         matrix.Transform
 	strokeColor paintColor
 	fillColor   paintColor
+	textPaint   backend.PaintOp // used by DrawText
+	paintOrder  paintOrder
+	deferred    []deferredPaint // painted after the markers, see Canvas.Paint
 
-	image *image.RGBA // shared output of `stroker` and `filler`
+	// shared output of `stroker` and `filler`,
+	// lazily allocated for a layer (see `Canvas.target`)
+	image   *image.RGBA
+	isLayer bool
+	shared  bool // draws into the target of the enclosing state (see Canvas.target)
 
 	mask *image.Alpha // optional
 }
 
-// return a new graphic state writing to `dst`
+// return a new graphic state, accumulating the edges of the paths
+// in `bounds` and writing to `dst`, or to a new layer if `dst` is nil.
+// `sess` provides the rendering options, and may be nil.
 // if parent is not nil, initialise state from it
-func newState(dst *image.RGBA, parent *state) state {
-	r := dst.Bounds()
-	dx, dy := r.Dx(), r.Dy()
+func newState(dst *image.RGBA, bounds image.Rectangle, parent *state, sess *session) state {
+	dx, dy := bounds.Dx(), bounds.Dy()
 	var out state
 	if parent != nil {
 		out = *parent
+		out.mask = nil
+		out.deferred = nil
 	} else {
+		out.samples = sess.antialiasing()
+		out.paintOrder = sess.rootPaintOrder()
+		out.nonScalingStroke = sess.isNonScalingStroke()
 		out.mat = matrix.Identity()
+		out.fillColor = plainColor(parser.RGBA{A: 1})
+		out.strokeColor = plainColor(parser.RGBA{A: 1})
+		out.textPaint = backend.FillNonZero
+		out.strokeStyle = sess.strokeStyle()
 	}
 
-	out.stroker = rasterx.NewDasher(dx, dy, rasterx.NewScannerGV(dx, dy, dst, r))
-	out.filler = rasterx.NewFiller(dx, dy, rasterx.NewScannerGV(dx, dy, dst, r))
+	out.bounds = bounds
+	out.stroker = rasterx.NewDasher(dx, dy, newScanner(bounds, sess, out.samples))
+	out.filler = rasterx.NewFiller(dx, dy, newScanner(bounds, sess, out.samples))
+	out.evenOddFiller = nil
+	out.colorSpace = sess.targetColorSpace()
+	out.session = sess
 	out.image = dst
+	out.isLayer = dst == nil
+	out.shared = false
 	return out
 }
 
 // SetAlphaMask inteprets `mask` as an alpha mask
 func (st *state) SetAlphaMask(mask backend.Canvas) {
-	st.mask = rgbToAlpha(mask.(*Canvas).state.image)
+	if st.shared {
+		st.warn(Warning{Feature: "mask", Message: "the mask of an element drawn without its own layer is ignored"})
+		return
+	}
+	gr := mask.(*Canvas)
+	st.mask = rgbToAlpha(gr.state.image, gr.bounds)
 }
 
 // Establishes a new clip region
@@ -138,7 +183,9 @@ func (st *state) Clip(evenOdd bool) {
 // floating point numbers in the range 0 to 1.
 // If the values passed in are outside that range, they will be clamped.
 // `stroke` controls whether stroking or filling operations are concerned.
+// The sRGB color is converted to Options.ColorSpace.
 func (st *state) SetColorRgba(c parser.RGBA, stroke bool) {
+	c = st.colorSpace.convert(c)
 	if stroke {
 		st.strokeColor = plainColor(c)
 	} else {
@@ -146,27 +193,6 @@ func (st *state) SetColorRgba(c parser.RGBA, stroke bool) {
 	}
 }
 
-func toPngBytes(m image.Image) ([]byte, error) {
-	var b bytes.Buffer
-
-	// Write the image into the buffer
-	err := png.Encode(&b, m)
-	if err != nil {
-		return nil, err
-	}
-
-	return b.Bytes(), nil
-}
-
-func saveToPngFile(filePath string, m image.Image) error {
-	b, err := toPngBytes(m)
-	if err != nil {
-		return err
-	}
-	err = ioutil.WriteFile(filePath, b, os.ModePerm)
-	return err
-}
-
 // SetColorPattern set the current paint color to the given pattern.
 // A pattern acts as a fill or stroke color, but permits complex textures.
 // It consists of a rectangle, fill with arbitrary content, which will be replicated
@@ -176,12 +202,24 @@ func saveToPngFile(filePath string, m image.Image) error {
 // in which it will painted.
 // `stroke` controls whether stroking or filling operations are concerned.
 func (st *state) SetColorPattern(pattern backend.Canvas, contentWidth backend.Fl, contentHeight backend.Fl, mat matrix.Transform, stroke bool) {
-	// FIXME:
-	fmt.Println(contentWidth, contentHeight, mat)
+	// FIXME: the pattern is not repeated
 	patternPixels := pattern.(*Canvas).state.image
+	if patternPixels == nil { // nothing has been drawn
+		patternPixels = new(image.RGBA)
+	}
+	// the pattern has been drawn with the current transform M, so that
+	// the pixel p shows the pixel (M mat M⁻¹)⁻¹ p of the pattern
+	toPattern, inv := st.mat, st.mat
+	toPattern.RightMultBy(mat)
+	if inv.Invert() == nil {
+		toPattern.RightMultBy(inv)
+	}
+	if toPattern.Invert() != nil {
+		toPattern = matrix.Identity()
+	}
 	var cf rasterx.ColorFunc = func(x, y int) color.Color {
-		fmt.Println(x, y)
-		return patternPixels.At(x, y)
+		px, py := toPattern.Apply(Fl(x)+0.5, Fl(y)+0.5)
+		return patternPixels.At(int(math.Floor(float64(px))), int(math.Floor(float64(py))))
 	}
 
 	if stroke {
@@ -189,16 +227,29 @@ func (st *state) SetColorPattern(pattern backend.Canvas, contentWidth backend.Fl
 	} else {
 		st.fillColor = funcColor(cf)
 	}
-	// FIXME:
-	// saveToPngFile(fmt.Sprintf("image%d.png", count), st.image)
-	// saveToPngFile(fmt.Sprintf("pattern%d.png", count), pattern.(*Canvas).state.image)
-	// applyPattern(st.image, pattern.(*Canvas).state.image)
-	// saveToPngFile(fmt.Sprintf("after_pattern%d.png", count), st.image)
 }
 
 // SetBlendingMode sets the blending mode, which is a CSS blend mode keyword.
 func (st *state) SetBlendingMode(mode string) {
-	log.Println("blend mode not supported")
+	st.warn(Warning{Feature: "blend-mode", Message: fmt.Sprintf("blend mode %q is not supported", mode)})
+}
+
+// strokeScale returns the factor converting the stroke width and
+// the dashes to device space.
+// Since rasterx strokes the path in device space with a circular pen,
+// the anisotropic transforms are approximated by their average scale:
+// sqrt(|det|) is exact for the similarity transforms (rotations,
+// reflections and uniform scales), for which the pen stays circular,
+// and is otherwise the geometric mean of the scales along the principal
+// axes, so that the area of the pen is preserved. (The Frobenius norm
+// is sqrt(2) times too large for these transforms, starting with the identity.)
+// The dashes are lengths along the path, which is transformed, so
+// they are scaled by the same factor to keep their proportions.
+func (st *state) strokeScale() Fl {
+	if st.nonScalingStroke {
+		return 1
+	}
+	return Fl(math.Sqrt(math.Abs(float64(st.mat.Determinant()))))
 }
 
 // Sets the current line width to be used by `Stroke`.
@@ -206,12 +257,9 @@ func (st *state) SetBlendingMode(mode string) {
 // that is circular in user space,
 // (though device-space pen may be an ellipse in general
 // due to scaling / shear / rotation of the CTM).
+// For non-scaling strokes (see Options.NonScalingStroke), the width is in device space instead.
 func (st *state) SetLineWidth(width backend.Fl) {
-	// TODO: correct the scaling
-	a, b, c, d := st.mat.A, st.mat.B, st.mat.C, st.mat.D
-	normA := math.Sqrt(float64(a*a + b*b + c*c + d*d))
-
-	st.strokeOptions.strokeWidth = floatToFixed(Fl(normA) * width)
+	st.strokeOptions.strokeWidth = floatToFixed(st.strokeScale() * width)
 	st.applyStrokeOptions()
 }
 
@@ -233,21 +281,39 @@ func (st *state) SetLineWidth(width backend.Fl) {
 // with alternating on and off portions of the size specified
 // by the single value.
 func (st *state) SetDash(dashes []backend.Fl, offset backend.Fl) {
-	st.dashes = make([]fixed.Int26_6, len(dashes))
+	scale := st.strokeScale()
+	st.dashes = make([]float64, len(dashes))
 	for i, d := range dashes {
-		st.dashes[i] = floatToFixed(d)
+		st.dashes[i] = float64(scale * d)
 	}
-	st.dashOffset = floatToFixed(offset)
+	st.dashOffset = float64(scale * offset)
 
-	st.applyDashes()
+	st.applyStrokeOptions()
 }
 
 // SetStrokeOptions sets additionnal options to be used when stroking
 // (in addition to SetLineWidth and SetDash)
+// The caps, the gaps and the miter joins may be replaced
+// according to Options.Stroke.
 func (st *state) SetStrokeOptions(opts backend.StrokeOptions) {
+	style := st.strokeStyle
 	st.strokeOptions.miterLimit = floatToFixed(opts.MiterLimit)
-	st.strokeOptions.lineCap = capToFunc[opts.LineCap]
-	st.strokeOptions.lineJoin = joinToFunc[opts.LineJoin]
+	st.strokeOptions.leadingCap = capToFunc[opts.LineCap]
+	if style.capL != nil {
+		st.strokeOptions.leadingCap = style.capL
+	}
+	st.strokeOptions.trailingCap = capToFunc[opts.LineCap]
+	if style.capT != nil {
+		st.strokeOptions.trailingCap = style.capT
+	}
+	st.strokeOptions.lineGap = style.gap
+	st.strokeOptions.lineJoin = rasterx.Miter
+	if int(opts.LineJoin) < len(joinToFunc) {
+		st.strokeOptions.lineJoin = joinToFunc[opts.LineJoin]
+	}
+	if style.overrideJoin && opts.LineJoin != backend.Round && opts.LineJoin != backend.Bevel {
+		st.strokeOptions.lineJoin = style.miterJoin
+	}
 	st.applyStrokeOptions()
 }
 
@@ -266,24 +332,84 @@ func (st *state) Transform(mt matrix.Transform) {
 
 // SetTextPaint adjusts how text shapes are rendered.
 func (st *state) SetTextPaint(op backend.PaintOp) {
-	log.Println("TextPaint is ignored")
+	st.textPaint = op
 }
 
-// apply the current stroke params to the rasterx stroker
+// SetElementID sets the id of the element drawn with the state,
+// reported by the warnings.
+func (st *state) SetElementID(id string) { st.elementID = id }
+
+// warn records `w`, for the element drawn with the state
+func (st *state) warn(w Warning) {
+	if w.ID == "" {
+		w.ID = st.elementID
+	}
+	st.session.warn(w)
+}
+
+// SetShapeRendering selects the anti-aliasing of the state,
+// if Options.Antialiasing is AntialiasAuto.
+func (st *state) SetShapeRendering(value string) {
+	if st.session != nil && st.session.shapeRendering {
+		st.setSamples(shapeRendering(value).samples(0))
+	}
+}
+
+// setSamples changes the anti-aliasing of the scanners
+func (st *state) setSamples(samples int) {
+	if samples == st.samples {
+		return
+	}
+	st.samples = samples
+	st.stroker.Scanner = newScanner(st.bounds, st.session, samples)
+	st.filler.Scanner = newScanner(st.bounds, st.session, samples)
+}
+
+// SetIsolation gives the state its own layer, if `isolated` is true.
+func (st *state) SetIsolation(isolated bool) {
+	if isolated {
+		st.shared = false
+	}
+}
+
+// SetVectorEffect makes the stroke width and dashes non-scaling,
+// if `effect` is "non-scaling-stroke" or Options.NonScalingStroke is set.
+func (st *state) SetVectorEffect(effect string) {
+	st.nonScalingStroke = effect == "non-scaling-stroke" || st.session.isNonScalingStroke()
+}
+
+// SetPaintOrder sets the order of the fill, the stroke and the markers,
+// unless Options.PaintOrder overrides it.
+func (st *state) SetPaintOrder(order string) {
+	if st.session != nil && st.session.followPaintOrder {
+		st.paintOrder = parsePaintOrder(order)
+	}
+}
+
+// apply the current stroke and dash params to the rasterx stroker;
+// the dasher only switches to dashing in its own SetStroke
 func (st *state) applyStrokeOptions() {
 	opts := st.strokeOptions
-	st.stroker.Stroker.SetStroke(opts.strokeWidth, opts.miterLimit, opts.lineCap, opts.lineCap, rasterx.RoundGap, opts.lineJoin)
+	st.stroker.SetStroke(opts.strokeWidth, opts.miterLimit, opts.leadingCap, opts.trailingCap, opts.lineGap, opts.lineJoin,
+		st.dashes, st.dashOffset)
 }
 
-// apply the current dash params to the rasterx stroker
-func (st *state) applyDashes() {
-	st.stroker.Dashes = st.dashes
-	st.stroker.DashOffset = st.dashOffset
+// fillOpacity returns the alpha of the fill color,
+// or 1 for patterns
+func (st *state) fillOpacity() Fl {
+	if c, ok := st.fillColor.(plainColor); ok {
+		return c.A
+	}
+	return 1
 }
 
 // TODO: handle patterns
 func (st *state) applyFillColor() {
-	st.filler.SetColor(st.fillColor.toRasterxColor())
+	c := st.fillColor.toRasterxColor()
+	st.filler.SetColor(c)
+	if st.evenOddFiller != nil {
+		st.evenOddFiller.SetColor(c)
+	}
 }
 
 // TODO: handle patterns
@@ -297,13 +423,28 @@ type Canvas struct {
 
 	rectangle [4]Fl // left, top, right, bottom
 
-	hasPath bool // to avoid useless call to the rasterizer
+	// current path, in user space, handed to the filler or the stroker
+	// only when painted
+	path    path
+	pathMat matrix.Transform // transformation when the path was started
+
+	bounds image.Rectangle // pixels of the output, which bound the layers
+
+	session *session // shared by all the canvas of one rendering, may be nil
+	// number of path segments drawn, shared with the groups,
+	// but not between the tiles (see session.addSegment)
+	segments *int64
+
+	shapes []sdfShape // painted, if session.recordsShapes()
 }
 
-func newCanvas(x, y, width, height Fl, dst *image.RGBA, parentState *state) *Canvas {
+func newCanvas(x, y, width, height Fl, dst *image.RGBA, parentState *state, sess *session) *Canvas {
 	return &Canvas{
-		state:     newState(dst, parentState),
+		state:     newState(dst, dst.Rect, parentState, sess),
 		rectangle: [4]Fl{x, y, x + width, y + height},
+		bounds:    dst.Rect,
+		session:   sess,
+		segments:  new(int64),
 	}
 }
 
@@ -311,38 +452,33 @@ func (cv *Canvas) State() backend.GraphicState {
 	return &cv.state
 }
 
-// apply the current transformation matrix to (x, y)
-func (cv *Canvas) transformPoint(x, y Fl) fixed.Point26_6 {
-	x, y = cv.state.mat.Apply(x, y)
-	return fixed.Point26_6{X: floatToFixed(x), Y: floatToFixed(y)}
+// addSegment appends `seg` to the current path
+func (cv *Canvas) addSegment(seg segment) {
+	if !cv.session.addSegment(cv.segments) {
+		return
+	}
+	if len(cv.path) == 0 {
+		cv.pathMat = cv.state.mat
+	}
+	cv.path = append(cv.path, seg)
 }
 
 func (cv *Canvas) MoveTo(x, y Fl) {
-	p := cv.transformPoint(x, y)
-	cv.state.stroker.Start(p)
-	cv.state.filler.Start(p)
-	cv.hasPath = true
+	cv.addSegment(newMoveTo(point{x, y}))
 }
 
 func (cv *Canvas) LineTo(x, y Fl) {
-	p := cv.transformPoint(x, y)
-	cv.state.stroker.Line(p)
-	cv.state.filler.Line(p)
-	cv.hasPath = true
+	cv.addSegment(newLineTo(point{x, y}))
 }
 
 func (cv *Canvas) CubicTo(x1, y1, x2, y2, x3, y3 Fl) {
-	p1 := cv.transformPoint(x1, y1)
-	p2 := cv.transformPoint(x2, y2)
-	p3 := cv.transformPoint(x3, y3)
-	cv.state.stroker.CubeBezier(p1, p2, p3)
-	cv.state.filler.CubeBezier(p1, p2, p3)
-	cv.hasPath = true
+	cv.addSegment(newCubeTo(point{x1, y1}, point{x2, y2}, point{x3, y3}))
 }
 
 func (cv *Canvas) ClosePath() {
-	cv.state.stroker.Stop(true)
-	cv.state.filler.Stop(true)
+	if len(cv.path) != 0 {
+		cv.path = append(cv.path, segment{op: closeOp})
+	}
 }
 
 // Returns the current canvas rectangle
@@ -350,42 +486,161 @@ func (cv *Canvas) GetRectangle() (left, top, right, bottom backend.Fl) {
 	return cv.rectangle[0], cv.rectangle[1], cv.rectangle[2], cv.rectangle[3]
 }
 
+// targetState returns the state owning the current target:
+// the current one, or the innermost enclosing state not shared
+func (cv *Canvas) targetState() *state {
+	st := &cv.state
+	for i := len(cv.states) - 1; st.shared; i-- {
+		st = &cv.states[i]
+	}
+	return st
+}
+
+// target returns the image to draw into, making sure that,
+// for a layer, it covers `r` (in absolute pixel coordinates).
+// It returns nil if nothing should be drawn.
+func (cv *Canvas) target(r image.Rectangle) *image.RGBA {
+	st := cv.targetState()
+	if !st.isLayer {
+		return st.image
+	}
+	r = r.Intersect(cv.bounds)
+	if r.Empty() || (st.image != nil && r.In(st.image.Rect)) {
+		return st.image
+	}
+
+	// grow the layer
+	if st.image != nil {
+		r = r.Union(st.image.Rect)
+	}
+	if !cv.session.allocLayer(r) {
+		return nil
+	}
+	img := getLayer(r)
+	if old := st.image; old != nil {
+		draw.Draw(img, old.Rect, old, old.Rect.Min, draw.Src)
+		cv.releaseLayer(old)
+	}
+	st.image = img
+	return img
+}
+
+// releaseLayer recycles `img`, which must not be used anymore
+func (cv *Canvas) releaseLayer(img *image.RGBA) {
+	cv.session.releaseLayer(img.Rect)
+	putLayer(img)
+}
+
+// pixelBounds returns the pixels touched by `extent`
+func pixelBounds(extent fixed.Rectangle26_6) image.Rectangle {
+	if extent.Min.X > extent.Max.X { // no edges
+		return image.Rectangle{}
+	}
+	return image.Rect(extent.Min.X.Floor(), extent.Min.Y.Floor(), extent.Max.X.Ceil(), extent.Max.Y.Ceil())
+}
+
+// drawPath renders the path accumulated in `f` on the current target
+// and clears it
+func (cv *Canvas) drawPath(f *rasterx.Filler) {
+	sc := f.Scanner.(scanner)
+	if img := cv.target(pixelBounds(sc.GetPathExtent())); img != nil {
+		sc.setTarget(img)
+		sc.Draw()
+	}
+	f.Clear()
+}
+
+// fillerFor returns the filler of the current state, or, for the evenodd
+// rule, which rasterx.ScannerGV ignores, a filler using a `cellScanner`.
+func (cv *Canvas) fillerFor(nonZero bool) *rasterx.Filler {
+	if _, isGV := cv.state.filler.Scanner.(*gvScanner); nonZero || !isGV {
+		return cv.state.filler
+	}
+	if cv.state.evenOddFiller == nil {
+		dx, dy := cv.bounds.Dx(), cv.bounds.Dy()
+		cv.state.evenOddFiller = rasterx.NewFiller(dx, dy, newCellScanner(cv.bounds, cv.session, 0))
+	}
+	return cv.state.evenOddFiller
+}
+
 // OnNewStack save the current graphic stack,
 // execute the given closure, and restore the stack.
 func (cv *Canvas) OnNewStack(f func()) {
+	if !cv.session.pushState(len(cv.states) + 1) {
+		return
+	}
+
 	cv.states = append(cv.states, cv.state) // save
-	cv.state = newState(image.NewRGBA(cv.state.image.Rect), &cv.state)
+	cv.state = newState(nil, cv.bounds, &cv.state, cv.session)
+	cv.state.shared = true // see SetIsolation
 
 	f() // execute
+	cv.paintDeferred()
 
-	if cv.state.mask != nil {
-		applyOpacityMask(cv.state.image, cv.state.mask)
-	}
+	layer, mask := cv.state.image, cv.state.mask
 	L := len(cv.states)
-	parent := cv.states[L-1]
-	// merge the state image with its parent
-	drawTo(parent.image, cv.state.image)
-
 	// restore
-	cv.state = parent
+	cv.state = cv.states[L-1]
 	cv.states = cv.states[:L-1]
+
+	if layer == nil { // nothing has been drawn
+		return
+	}
+	if mask != nil {
+		applyOpacityMask(layer, mask)
+	}
+	// merge the layer with its parent
+	if st := cv.targetState(); st.isLayer && st.image == nil {
+		// composing over a transparent image is a no-op:
+		// simply hand over the layer
+		st.image = layer
+		return
+	}
+	if dst := cv.target(layer.Rect); dst != nil {
+		drawTo(dst, layer)
+	}
+	cv.releaseLayer(layer)
 }
 
 // NewGroup creates a new drawing target with the given
 // bounding box. It may be filled by graphic operations
 // before being passed to the `DrawWithOpacity`, `SetColorPattern`
 // and `DrawAsMask` methods.
+// The layer of the group is only allocated when something is drawn.
 func (cv *Canvas) NewGroup(x backend.Fl, y backend.Fl, width backend.Fl, height backend.Fl) backend.Canvas {
-	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
-	out := newCanvas(x, y, width, height, img, &cv.state)
-	return out
+	r := image.Rect(0, 0, int(width), int(height))
+	return &Canvas{
+		state:     newState(nil, r, &cv.state, cv.session),
+		rectangle: [4]Fl{x, y, x + width, y + height},
+		bounds:    r,
+		session:   cv.session,
+		segments:  cv.segments,
+	}
 }
 
 // DrawWithOpacity draw the given target to the main target, applying the given opacity (in [0,1]).
 func (cv *Canvas) DrawWithOpacity(opacity backend.Fl, group backend.Canvas) {
 	gr := group.(*Canvas)
-	applyOpacity(gr.state.image, opacity)
-	drawTo(cv.state.image, gr.state.image)
+	gr.paintDeferred()
+	layer := gr.state.image
+	if layer != nil {
+		defer cv.releaseLayer(layer)
+	}
+	if cv.session.failed() {
+		return
+	}
+	if cv.session.recordsShapes() {
+		// the opacity does not change the geometry
+		cv.shapes = append(cv.shapes, gr.shapes...)
+		return
+	}
+	if layer == nil { // nothing has been drawn
+		return
+	}
+	applyOpacity(layer, opacity)
+	if dst := cv.target(layer.Rect); dst != nil {
+		drawTo(dst, layer)
+	}
 }
 
 // Paint actually shows the current path on the target,
@@ -394,28 +649,81 @@ func (cv *Canvas) DrawWithOpacity(opacity backend.Fl, group backend.Canvas) {
 // stroke settings.
 // After this call, the current path will be cleared.
 func (cv *Canvas) Paint(op backend.PaintOp) {
-	doStroke := op&backend.Stroke != 0
-	doFill := op&(backend.FillEvenOdd|backend.FillNonZero) != 0
+	hasPath := len(cv.path) != 0
+	doStroke := op&backend.Stroke != 0 && hasPath
+	doFill := op&(backend.FillEvenOdd|backend.FillNonZero) != 0 && hasPath
+	if !cv.session.checkContext() {
+		doStroke, doFill = false, false
+	}
+	if cv.session.recordsShapes() {
+		if doStroke || doFill {
+			cv.recordShape(op)
+		}
+		cv.path = cv.path[:0]
+		return
+	}
 
-	if doStroke && cv.hasPath {
-		cv.state.applyStrokeColor()
-		cv.state.stroker.Stroker.Draw()
-		cv.state.stroker.Clear()
+	// the parser draws the markers once the shape is painted:
+	// the parts painted after them are deferred until the
+	// state is closed (see Canvas.paintDeferred)
+	if later := op & cv.state.paintOrder.afterMarkers; later != 0 && (doStroke || doFill) {
+		cv.state.deferred = append(cv.state.deferred, deferredPaint{append(path(nil), cv.path...), cv.pathMat, later})
+		doStroke = doStroke && later&backend.Stroke == 0
+		doFill = doFill && later&(backend.FillEvenOdd|backend.FillNonZero) == 0
 	}
 
-	if doFill && cv.hasPath {
+	stroke := func() {
+		cv.state.applyStrokeColor()
+		// open sub-paths are capped
+		cv.path.addTo(cv.state.stroker, cv.pathMat, false)
+		cv.drawPath(&cv.state.stroker.Filler)
+	}
+	fill := func() {
+		filler := cv.fillerFor(op&backend.FillNonZero != 0)
 		cv.state.applyFillColor()
-		cv.state.filler.SetWinding(op&backend.FillNonZero != 0)
-		cv.state.filler.Draw()
-		cv.state.filler.Clear()
+		filler.SetWinding(op&backend.FillNonZero != 0)
+		// filling implicitly closes the sub-paths
+		cv.path.addTo(filler, cv.pathMat, true)
+		cv.drawPath(filler)
+	}
+
+	// by default, the stroke is painted over the fill
+	if doStroke && cv.state.paintOrder.strokeFirst {
+		stroke()
+		doStroke = false
+	}
+	if doFill {
+		fill()
+	}
+	if doStroke {
+		stroke()
 	}
 
-	// reset the path and the mask
-	cv.hasPath = false
+	cv.path = cv.path[:0]
+}
+
+// deferredPaint is a painting done after the markers
+type deferredPaint struct {
+	path path
+	mat  matrix.Transform
+	op   backend.PaintOp
+}
+
+// paintDeferred paints the shapes deferred after the markers
+// in the current state
+func (cv *Canvas) paintDeferred() {
+	deferred, order := cv.state.deferred, cv.state.paintOrder
+	cv.state.deferred = nil
+	cv.state.paintOrder.afterMarkers = 0 // the markers are drawn
+	for _, d := range deferred {
+		cv.path, cv.pathMat = d.path, d.mat
+		cv.Paint(d.op)
+	}
+	cv.state.paintOrder = order
 }
 
 // Adds a rectangle of the given size to the current path,
-// at position ``(x, y)`` in user-space coordinates.
+// at position (x, y) in user-space coordinates.
 // (X,Y) coordinates are the top left corner of the rectangle.
 // Note that this method may be expressed using MoveTo and LineTo,
 // but may be implemented more efficiently.
@@ -427,25 +735,61 @@ func (cv *Canvas) Rectangle(x backend.Fl, y backend.Fl, width backend.Fl, height
 	cv.ClosePath()
 }
 
-// AddFont register a new font to be used in the output and return
-// an object used to store associated metadata.
-// This method will be called several times with the same `font` argument,
-// so caching is advised.
-func (cv *Canvas) AddFont(font pango.Font, content []byte) *backend.Font {
-	return &backend.Font{}
+// DrawRasterImage draws the given image at the current point, with the given dimensions.
+// Typical format for image.Content are PNG, JPEG, GIF.
+// The image is smoothed, unless its Rendering is "pixelated" or "crisp-edges".
+func (cv *Canvas) DrawRasterImage(img backend.RasterImage, width backend.Fl, height backend.Fl) {
+	if !cv.session.checkContext() {
+		return
+	}
+	src, _, err := image.Decode(img.Content)
+	if err != nil {
+		cv.state.warn(Warning{Feature: "image", Message: fmt.Sprintf("invalid raster image: %s", err)})
+		return
+	}
+	cv.drawImage(src, width, height, img.Rendering)
 }
 
-// DrawText draws the given text using the current fill color.
-// The rendering may be altered by a preivous `SetTextPaint` call.
-// The fonts of the runs have been registred with `AddFont`.
-func (cv *Canvas) DrawText(texts []backend.TextDrawing) {
-	panic("not implemented") // TODO: Implement
-}
+// drawImage maps the pixels of `src` to (0, 0, width, height)
+// in user space, with the interpolation given by `rendering`.
+func (cv *Canvas) drawImage(src image.Image, width, height Fl, rendering string) {
+	if cv.session.recordsShapes() {
+		cv.state.warn(Warning{Feature: "distance-field", Message: "images are ignored by the distance fields"})
+		return
+	}
+	src = cv.state.colorSpace.convertImage(src)
+	sr := src.Bounds()
+	if sr.Empty() {
+		return
+	}
 
-// DrawRasterImage draws the given image at the current point, with the given dimensions.
-// Typical format for image.Content are PNG, JPEG, GIF.
-func (cv *Canvas) DrawRasterImage(image backend.RasterImage, width backend.Fl, height backend.Fl) {
-	log.Println("nested image are not supported")
+	// map the pixels of the image to (0, 0, width, height),
+	// then to the output
+	mat := cv.state.mat
+	mat.RightMultBy(matrix.Scaling(width/Fl(sr.Dx()), height/Fl(sr.Dy())))
+	mat.RightMultBy(matrix.Translation(-Fl(sr.Min.X), -Fl(sr.Min.Y)))
+	s2d := f64.Aff3{
+		float64(mat.A), float64(mat.C), float64(mat.E),
+		float64(mat.B), float64(mat.D), float64(mat.F),
+	}
+
+	var interpolator xdraw.Interpolator = xdraw.BiLinear
+	switch rendering {
+	case "pixelated", "crisp-edges":
+		interpolator = xdraw.NearestNeighbor
+	}
+
+	// the pixels covered by the image
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, corner := range [4][2]Fl{{0, 0}, {width, 0}, {0, height}, {width, height}} {
+		x, y := cv.state.mat.Apply(corner[0], corner[1])
+		minX, maxX = math.Min(minX, float64(x)), math.Max(maxX, float64(x))
+		minY, maxY = math.Min(minY, float64(y)), math.Max(maxY, float64(y))
+	}
+	r := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+	if dst := cv.target(r); dst != nil {
+		interpolator.Transform(dst, s2d, src, sr, xdraw.Over, nil)
+	}
 }
 
 func toRasterxGradient(grad backend.GradientLayout, width, heigth Fl) rasterx.Gradient {
@@ -493,24 +837,46 @@ func toRasterxGradient(grad backend.GradientLayout, width, heigth Fl) rasterx.Gr
 	}
 }
 
-var count = 0
-
 // DrawGradient draws the given gradient at the current point.
-// Solid gradient are already handled, meaning that only linear and radial
-// must be taken care of.
+// Solid gradient are already handled, meaning that only linear, radial,
+// conic and mesh gradients must be taken care of.
 func (cv *Canvas) DrawGradient(gradient backend.GradientLayout, width backend.Fl, height backend.Fl) {
-	fmt.Println("DrawGradient", width, height)
-	rg := toRasterxGradient(gradient, width, height)
-
-	fn := rg.GetColorFunction(1).(rasterx.ColorFunc)
-
-	cv.state.filler.Scanner.SetColor(fn)
-	cv.Rectangle(0, 0, width, height)
-	cv.state.filler.Draw()
-	cv.state.filler.Clear()
-
-	cv.hasPath = false
+	if !cv.session.checkContext() || cv.session.recordsShapes() {
+		// the shape filled by the gradient has already been recorded
+		return
+	}
+	gradient.Colors = cv.state.colorSpace.convertColors(gradient.Colors)
+	newRectangle(0, 0, width, height).addTo(cv.state.filler, cv.state.mat, true)
+	if gradient.GradientKind.Kind == "conic" {
+		// the center and the starting angle are mapped to device space
+		mat := cv.state.mat
+		gradient.Coords[0], gradient.Coords[1] = mat.Apply(gradient.Coords[0], gradient.Coords[1])
+		gradient.Coords[2] += Fl(math.Atan2(float64(mat.B), float64(mat.A)))
+	}
+	if gradient.GradientKind.Kind != "mesh" {
+		cv.state.filler.Scanner.SetColor(gradientColorFunc(gradient, width, height, cv.session.dithering()))
+		cv.drawPath(cv.state.filler)
+		return
+	}
 
-	saveToPngFile(fmt.Sprintf("gradient%d.png", count), cv.state.image)
-	count++
+	// the patches are mapped to device space, and rasterized
+	// on a temporary layer, covering the pixels of the rectangle
+	r := pixelBounds(cv.state.filler.Scanner.(scanner).GetPathExtent()).Intersect(cv.bounds)
+	if !cv.session.allocLayer(r) {
+		cv.state.filler.Clear()
+		return
+	}
+	layer := getLayer(r)
+	defer cv.releaseLayer(layer)
+	patches := make([]backend.MeshPatch, len(gradient.Patches))
+	for i, patch := range gradient.Patches {
+		for j, p := range patch.Points {
+			patch.Points[j][0], patch.Points[j][1] = cv.state.mat.Apply(p[0], p[1])
+		}
+		copy(patch.Colors[:], cv.state.colorSpace.convertColors(patch.Colors[:]))
+		patches[i] = patch
+	}
+	rasterizeMesh(layer, patches, cv.session.dithering())
+	cv.state.filler.Scanner.SetColor(rasterx.ColorFunc(func(x, y int) color.Color { return layer.RGBAAt(x, y) }))
+	cv.drawPath(cv.state.filler)
 }
@@ -1,13 +1,21 @@
 package gosvg
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/benoitkugler/webrender/backend"
 	"github.com/benoitkugler/webrender/css/parser"
+	"github.com/benoitkugler/webrender/matrix"
 )
 
 // test basic drawing commands
@@ -44,7 +52,7 @@ func TestDraw(t *testing.T) {
 func TestRect(t *testing.T) {
 	var width, height Fl = 600, 600
 	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
-	output := newCanvas(0, 0, width, height, img, nil)
+	output := newCanvas(0, 0, width, height, img, nil, nil)
 	output.State().SetColorRgba(parser.RGBA{R: 0, G: 0.5, B: 0.5, A: 0.5}, false)
 	output.State().SetColorRgba(parser.RGBA{R: 0.5, G: 0.1, B: 0.5, A: 1}, true)
 	output.State().SetLineWidth(3)
@@ -56,7 +64,7 @@ func TestRect(t *testing.T) {
 func TestStack(t *testing.T) {
 	var width, height Fl = 600, 600
 	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
-	output := newCanvas(0, 0, width, height, img, nil)
+	output := newCanvas(0, 0, width, height, img, nil, nil)
 
 	output.OnNewStack(func() {
 		output.State().SetColorRgba(parser.RGBA{R: 0, G: 0.5, B: 0.5, A: 0.5}, false)
@@ -83,6 +91,349 @@ func TestStack(t *testing.T) {
 	saveToPngFile("tmp.png", output.state.image)
 }
 
+func TestPaintOrder(t *testing.T) {
+	red, blue := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}
+	for _, strokeFirst := range []bool{false, true} {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		sess := newSession(context.Background(), Limits{})
+		sess.paintOrder = paintOrder{strokeFirst: strokeFirst}
+		output := newCanvas(0, 0, 100, 100, img, nil, sess)
+		output.State().SetColorRgba(parser.RGBA{R: 1, A: 1}, false)
+		output.State().SetColorRgba(parser.RGBA{B: 1, A: 1}, true)
+		output.State().SetLineWidth(10)
+		output.Rectangle(20, 20, 60, 60)
+		output.Paint(backend.FillNonZero | backend.Stroke)
+
+		// the inner half of the stroke
+		inner := img.RGBAAt(22, 50)
+		if strokeFirst && inner != red {
+			t.Fatalf("expected fill over the stroke, got %v", inner)
+		} else if !strokeFirst && inner != blue {
+			t.Fatalf("expected stroke over the fill, got %v", inner)
+		}
+		// the outer half is always stroked
+		if outer := img.RGBAAt(18, 50); outer != blue {
+			t.Fatalf("expected stroke, got %v", outer)
+		}
+	}
+}
+
+func TestPaintOrderElements(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="60" height="60">
+	%s
+	<marker id="m" markerWidth="20" markerHeight="20" refX="10" refY="10" markerUnits="userSpaceOnUse">
+		<rect width="20" height="20" fill="blue"/>
+	</marker>
+	<g %s>
+		<path d="M 10 10 L 50 10 L 50 50 Z" fill="red" stroke="lime" stroke-width="4" marker-start="url(#m)"/>
+	</g>
+	</svg>`
+	red, blue, lime := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}, color.RGBA{G: 0xff, A: 0xff}
+	for _, tt := range []struct {
+		order        string
+		sheet        bool       // the order is set by a style sheet
+		paintOrder   string     // Options.PaintOrder
+		fill, stroke color.RGBA // at (35, 25) and (30, 31), covered by the marker
+	}{
+		{"normal", false, "", blue, blue},
+		{"markers", false, "", red, lime},
+		{"stroke markers", false, "", red, blue},
+		{"fill markers", false, "", blue, lime},
+		{"markers", false, "normal", blue, blue},
+		{"markers", true, "", red, lime},
+		{"stroke markers", true, "", red, blue},
+	} {
+		style, attr := "", fmt.Sprintf(`paint-order="%s"`, tt.order)
+		if tt.sheet {
+			style, attr = fmt.Sprintf("<style>g { paint-order: %s }</style>", tt.order), ""
+		}
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(fmt.Sprintf(src, style, attr)), &Options{PaintOrder: tt.paintOrder})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rgba := img.(*image.RGBA)
+		if fill, stroke := rgba.RGBAAt(35, 25), rgba.RGBAAt(30, 31); fill != tt.fill || stroke != tt.stroke {
+			t.Fatalf("%s (%v, %s): unexpected pixels %v %v", tt.order, tt.sheet, tt.paintOrder, fill, stroke)
+		}
+	}
+}
+
+func TestNonScalingStroke(t *testing.T) {
+	for _, tt := range []struct {
+		scale      Fl
+		nonScaling bool
+		rows       [3]uint8 // alpha of the rows 8, 9 and 10
+	}{
+		{1, false, [3]uint8{0, 0, 0xff}},
+		{4, false, [3]uint8{0x7f, 0xff, 0xff}},
+		{4, true, [3]uint8{0, 0, 0xff}},
+	} {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 20))
+		sess := newSession(context.Background(), Limits{})
+		sess.nonScalingStroke = tt.nonScaling
+		output := newCanvas(0, 0, 100, 20, img, nil, sess)
+		output.State().Transform(matrix.Scaling(tt.scale, tt.scale))
+		output.State().SetLineWidth(1)
+		// the line is at y = 10.5 in device space
+		output.MoveTo(0, 10.5/tt.scale)
+		output.LineTo(80/tt.scale, 10.5/tt.scale)
+		output.Paint(backend.Stroke)
+
+		for i, exp := range tt.rows {
+			if got := img.RGBAAt(40, 8+i).A; got != exp && got != exp+1 && got+1 != exp {
+				t.Fatalf("scale %g (%v), row %d: expected %d, got %d", tt.scale, tt.nonScaling, 8+i, exp, got)
+			}
+		}
+	}
+}
+
+func TestStrokeScale(t *testing.T) {
+	for _, tt := range []struct {
+		mat matrix.Transform
+		exp Fl
+	}{
+		{matrix.Identity(), 1},
+		{matrix.Scaling(3, 3), 3},
+		{matrix.Rotation(0.7), 1},
+		{matrix.Scaling(-2, 2), 2},
+		{matrix.Scaling(4, 1), 2}, // the geometric mean of the axes
+		{matrix.New(2, 0, 1, 2, 0, 0), 2},
+	} {
+		st := state{mat: tt.mat}
+		if got := st.strokeScale(); math.Abs(float64(got-tt.exp)) > 1e-5 {
+			t.Fatalf("%v: expected %g, got %g", tt.mat, tt.exp, got)
+		}
+		st.nonScalingStroke = true
+		if got := st.strokeScale(); got != 1 {
+			t.Fatalf("%v: expected 1 for a non-scaling stroke, got %g", tt.mat, got)
+		}
+	}
+}
+
+func TestScaledDashes(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 20))
+	output := newCanvas(0, 0, 100, 20, img, nil, nil)
+	output.State().Transform(matrix.Scaling(2, 2))
+	output.State().SetLineWidth(2)
+	output.State().SetDash([]Fl{5, 5}, 2.5)
+	output.MoveTo(0, 5)
+	output.LineTo(50, 5)
+	output.Paint(backend.Stroke)
+
+	// the dashes are 10 pixels long, starting 5 pixels in the pattern,
+	// like the geometry and the width
+	for _, tt := range []struct {
+		x      int
+		inDash bool
+	}{{2, true}, {7, false}, {12, false}, {17, true}, {22, true}, {27, false}} {
+		if got := img.RGBAAt(tt.x, 10).A; (got == 0xff) != tt.inDash || (got != 0 && !tt.inDash) {
+			t.Fatalf("x=%d: unexpected alpha %d", tt.x, got)
+		}
+	}
+	for y, exp := range map[int]uint8{7: 0, 8: 0xff, 11: 0xff, 12: 0} {
+		if got := img.RGBAAt(2, y).A; got != exp {
+			t.Fatalf("y=%d: expected alpha %d, got %d", y, exp, got)
+		}
+	}
+}
+
+func TestVectorEffect(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="60">
+	<style>.n { vector-effect: non-scaling-stroke }</style>
+	<g transform="scale(4, 4)" stroke="black" stroke-width="1">
+		<g vector-effect="non-scaling-stroke">
+			<line x1="0" y1="2.625" x2="20" y2="2.625" vector-effect="non-scaling-stroke"/>
+			<line x1="0" y1="7.625" x2="20" y2="7.625"/>
+		</g>
+		<line class="n" x1="0" y1="12.625" x2="20" y2="12.625"/>
+	</g>
+	</svg>`
+	for _, tt := range []struct {
+		nonScaling bool   // Options.NonScalingStroke
+		widths     [3]int // opaque rows
+	}{
+		{false, [3]int{1, 3, 1}}, // the property is not inherited
+		{true, [3]int{1, 1, 1}},
+	} {
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &Options{NonScalingStroke: tt.nonScaling})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rgba := img.(*image.RGBA)
+		for i, exp := range tt.widths {
+			width := 0
+			for y := 20 * i; y < 20*(i+1); y++ {
+				if rgba.RGBAAt(40, y).A == 0xff {
+					width++
+				}
+			}
+			if width != exp {
+				t.Fatalf("%v, line %d: expected width %d, got %d", tt.nonScaling, i, exp, width)
+			}
+		}
+	}
+}
+
+func TestPaintPath(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 20))
+	output := newCanvas(0, 0, 100, 20, img, nil, nil)
+	output.MoveTo(10, 10.5)
+	output.LineTo(90, 10.5)
+	// like the SVG renderer, the paint is set up after the path
+	output.State().SetLineWidth(6)
+	output.State().SetColorRgba(parser.RGBA{A: 1}, true)
+	output.Paint(backend.Stroke)
+	if got := img.RGBAAt(50, 8).A; got != 0xff {
+		t.Fatalf("expected the stroke width to be applied, got alpha %d", got)
+	}
+	if len(output.path) != 0 {
+		t.Fatal("expected the path to be cleared after Paint")
+	}
+
+	// filling only does not feed the stroker
+	output.Rectangle(10, 0, 10, 10)
+	output.Paint(backend.FillNonZero)
+	if ext := output.state.stroker.Scanner.GetPathExtent(); ext.Max.X > ext.Min.X {
+		t.Fatalf("unexpected stroker content: %v", ext)
+	}
+	if got := img.RGBAAt(15, 5).A; got != 0xff {
+		t.Fatalf("expected a filled rectangle, got alpha %d", got)
+	}
+}
+
+func TestLayer(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	output := newCanvas(0, 0, 100, 100, img, nil, nil)
+
+	output.OnNewStack(func() {
+		output.State().SetIsolation(true)
+		output.OnNewStack(func() {
+			output.State().SetColorRgba(parser.RGBA{R: 1, A: 1}, false)
+			output.Rectangle(10, 20, 30, 40)
+			output.Paint(backend.FillNonZero)
+		})
+		// the nested state draws into the layer,
+		// which only covers the rectangle
+		if r := output.state.image.Rect; r != image.Rect(10, 20, 40, 60) {
+			t.Fatalf("unexpected layer bounds %v", r)
+		}
+
+		// the mask also applies to the content of the nested state
+		mask := output.NewGroup(0, 0, 100, 100)
+		mask.State().SetColorRgba(parser.RGBA{R: 1, G: 1, B: 1, A: 1}, false)
+		mask.Rectangle(0, 0, 25, 100)
+		mask.Paint(backend.FillNonZero)
+		output.State().SetAlphaMask(mask)
+	})
+
+	if c := img.RGBAAt(15, 30); c != (color.RGBA{R: 0xff, A: 0xff}) {
+		t.Fatalf("expected red pixel, got %v", c)
+	}
+	if c := img.RGBAAt(35, 30); c != (color.RGBA{}) {
+		t.Fatalf("expected masked pixel, got %v", c)
+	}
+}
+
+func TestMaskIsolation(t *testing.T) {
+	// the mask is set by an attribute, or by a style sheet
+	for _, styleSheet := range []string{"", `<style>.m { mask: url(#m) }</style>`} {
+		mask := `mask="url(#m)"`
+		if styleSheet != "" {
+			mask = `class="m"`
+		}
+		src := `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20">` + styleSheet + `
+		<mask id="m"><rect width="10" height="20" fill="white"/></mask>
+		<filter id="f"><feOffset dx="5"/></filter>
+		<g ` + mask + `>
+			<rect width="20" height="10" fill="red"/>
+			<rect y="10" width="20" height="10" fill="blue" filter="url(#f)"/>
+		</g>
+		</svg>`
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(src), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rgba := img.(*image.RGBA)
+		for _, tt := range []struct {
+			x, y int
+			exp  color.RGBA
+		}{
+			{5, 5, color.RGBA{R: 0xff, A: 0xff}},
+			{15, 5, color.RGBA{}},
+			{2, 15, color.RGBA{}}, // offset by the filter
+			{7, 15, color.RGBA{B: 0xff, A: 0xff}},
+			{15, 15, color.RGBA{}},
+		} {
+			if got := rgba.RGBAAt(tt.x, tt.y); got != tt.exp {
+				t.Fatalf("%q: unexpected pixel at (%d, %d): %v", styleSheet, tt.x, tt.y, got)
+			}
+		}
+	}
+}
+
+func TestSharedLayer(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	sess := newSession(context.Background(), Limits{MaxLayerBytes: 1})
+	output := newCanvas(0, 0, 100, 100, img, nil, sess)
+
+	// the states which are not isolated draw into their parent
+	output.OnNewStack(func() {
+		output.OnNewStack(func() {
+			output.State().SetColorRgba(parser.RGBA{R: 1, A: 1}, false)
+			output.Rectangle(10, 20, 30, 40)
+			output.Paint(backend.FillNonZero)
+		})
+		// and so do the empty groups
+		output.DrawWithOpacity(0.5, output.NewGroup(0, 0, 100, 100))
+
+		mask := output.NewGroup(0, 0, 100, 100)
+		output.State().SetAlphaMask(mask)
+	})
+	if err := sess.error(); err != nil {
+		t.Fatal(err)
+	}
+	if c := img.RGBAAt(35, 30); c != (color.RGBA{R: 0xff, A: 0xff}) {
+		t.Fatalf("expected red pixel, got %v", c)
+	}
+	if warnings := sess.getWarnings(); len(warnings) != 1 || warnings[0].Feature != "mask" {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}
+
+func TestDrawRasterImage(t *testing.T) {
+	// a 2x2 image with 4 colors
+	colors := [4]color.RGBA{{R: 0xff, A: 0xff}, {G: 0xff, A: 0xff}, {B: 0xff, A: 0xff}, {A: 0xff}}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i, c := range colors {
+		src.SetRGBA(i%2, i/2, c)
+	}
+	content, err := toPngBytes(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rendering := range []string{"pixelated", "auto"} {
+		img := image.NewRGBA(image.Rect(0, 0, 50, 50))
+		output := newCanvas(0, 0, 50, 50, img, nil, nil)
+		output.OnNewStack(func() {
+			output.State().Transform(matrix.Translation(5, 5))
+			output.DrawRasterImage(backend.RasterImage{Content: bytes.NewReader(content), Rendering: rendering}, 20, 20)
+		})
+
+		if c := img.RGBAAt(4, 4); c != (color.RGBA{}) {
+			t.Fatalf("expected transparent pixel, got %v", c)
+		}
+		if c := img.RGBAAt(5, 5); c != colors[0] {
+			t.Fatalf("expected %v, got %v", colors[0], c)
+		}
+		// the pixels near the center are smoothed
+		pixelated := img.RGBAAt(14, 14) == colors[0] && img.RGBAAt(15, 15) == colors[3]
+		if pixelated != (rendering == "pixelated") {
+			t.Fatalf("%s: unexpected pixels %v %v", rendering, img.RGBAAt(14, 14), img.RGBAAt(15, 15))
+		}
+	}
+}
+
 func TestGradient(t *testing.T) {
 	input := `
 	<?xml version="1.0"?>
@@ -131,3 +482,24 @@ func TestGradient(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func toPngBytes(m image.Image) ([]byte, error) {
+	var b bytes.Buffer
+
+	// Write the image into the buffer
+	err := png.Encode(&b, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func saveToPngFile(filePath string, m image.Image) error {
+	b, err := toPngBytes(m)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filePath, b, os.ModePerm)
+	return err
+}
@@ -0,0 +1,34 @@
+package main
+
+import "github.com/benoitkugler/gosvg/internal/lru"
+
+// rendered is an encoded image, as sent to the clients
+type rendered struct {
+	contentType string
+	data        []byte
+}
+
+// imageCache stores the most recently used images,
+// up to `maxBytes` of encoded data.
+// It is safe for concurrent use.
+type imageCache struct {
+	images *lru.Cache // of rendered, by size in bytes
+}
+
+func newImageCache(maxBytes int64) *imageCache {
+	return &imageCache{images: lru.New(maxBytes)}
+}
+
+func (c *imageCache) get(key string) (rendered, bool) {
+	out, ok := c.images.Get(key)
+	if !ok {
+		return rendered{}, false
+	}
+	return out.(rendered), true
+}
+
+// add stores `value`, evicting the least recently used entries
+// if needed. Values bigger than the whole cache are not stored.
+func (c *imageCache) add(key string, value rendered) {
+	c.images.Add(key, value, int64(len(value.data)))
+}
@@ -0,0 +1,38 @@
+// Command gosvg-server renders SVG images over HTTP.
+//
+// POST /render, with the SVG image as body, returns the image encoded
+// as PNG or JPEG. The optional query parameters are:
+//
+//	width, height: the size of the output, in pixels
+//	scale: a factor applied to the size of the output
+//	background: a CSS color, transparent by default
+//	format: "png" (the default) or "jpeg"
+//
+// At most -max-renderings images are rendered at the same time,
+// the other requests waiting for their turn.
+//
+// GET /healthz returns 200 when the server is up.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	cfg := defaultConfig
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	flag.Int64Var(&cfg.MaxBodyBytes, "max-body", cfg.MaxBodyBytes, "maximum size of the SVG images, in bytes")
+	flag.Int64Var(&cfg.MaxPixels, "max-pixels", cfg.MaxPixels, "maximum number of pixels of the output images")
+	flag.Int64Var(&cfg.MaxLayerBytes, "max-layers", cfg.MaxLayerBytes, "maximum memory used by the layers of one rendering, in bytes")
+	flag.IntVar(&cfg.MaxDepth, "max-depth", cfg.MaxDepth, "maximum nesting of the graphic states")
+	flag.IntVar(&cfg.MaxPathSegments, "max-segments", cfg.MaxPathSegments, "maximum number of path segments of one rendering")
+	flag.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "maximum duration of one rendering")
+	flag.IntVar(&cfg.MaxRenderings, "max-renderings", cfg.MaxRenderings, "maximum number of renderings running at the same time")
+	flag.Int64Var(&cfg.CacheBytes, "cache", cfg.CacheBytes, "size of the cache of rendered images, in bytes (0 to disable)")
+	flag.Parse()
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, newServer(cfg).routes()))
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/benoitkugler/gosvg"
+	"github.com/benoitkugler/webrender/css/parser"
+)
+
+// config stores the limits of the server
+type config struct {
+	MaxBodyBytes    int64         // of the SVG images
+	MaxPixels       int64         // of the output images
+	MaxLayerBytes   int64         // of the intermediate layers of one rendering
+	MaxDepth        int           // of the nested graphic states
+	MaxPathSegments int           // of one rendering
+	Timeout         time.Duration // of one rendering
+	MaxRenderings   int           // running at the same time, the other requests wait
+	CacheBytes      int64         // of encoded images kept in memory, 0 to disable the cache
+}
+
+var defaultConfig = config{
+	MaxBodyBytes:    4 << 20,
+	MaxPixels:       4096 * 4096,
+	MaxLayerBytes:   256 << 20,
+	MaxDepth:        256,
+	MaxPathSegments: 1 << 22,
+	Timeout:         10 * time.Second,
+	MaxRenderings:   runtime.NumCPU(),
+	CacheBytes:      64 << 20,
+}
+
+type server struct {
+	cfg   config
+	slots chan struct{} // one per running rendering
+	cache *imageCache   // nil if disabled
+}
+
+func newServer(cfg config) *server {
+	if cfg.MaxRenderings <= 0 {
+		cfg.MaxRenderings = 1
+	}
+	out := &server{cfg: cfg, slots: make(chan struct{}, cfg.MaxRenderings)}
+	if cfg.CacheBytes > 0 {
+		out.cache = newImageCache(cfg.CacheBytes)
+	}
+	return out
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/render", s.handleRender)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	return mux
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+// renderParams are the query parameters of /render
+type renderParams struct {
+	width, height int
+	scale         float64
+	background    color.NRGBA // transparent by default
+	format        string      // png or jpeg
+}
+
+func parseRenderParams(r *http.Request) (renderParams, error) {
+	query := r.URL.Query()
+	out := renderParams{format: "png"}
+	var err error
+	if v := query.Get("width"); v != "" {
+		if out.width, err = strconv.Atoi(v); err != nil || out.width <= 0 {
+			return out, fmt.Errorf("invalid width %q", v)
+		}
+	}
+	if v := query.Get("height"); v != "" {
+		if out.height, err = strconv.Atoi(v); err != nil || out.height <= 0 {
+			return out, fmt.Errorf("invalid height %q", v)
+		}
+	}
+	if v := query.Get("scale"); v != "" {
+		if out.scale, err = strconv.ParseFloat(v, 64); err != nil || !(out.scale > 0 && out.scale <= 100) {
+			return out, fmt.Errorf("invalid scale %q", v)
+		}
+	}
+	if v := query.Get("background"); v != "" {
+		c := parser.ParseColorString(v)
+		if c.Type != parser.ColorRGBA {
+			return out, fmt.Errorf("invalid background %q", v)
+		}
+		out.background = color.NRGBAModel.Convert(c.RGBA).(color.NRGBA)
+	}
+	if v := query.Get("format"); v != "" {
+		if v != "png" && v != "jpeg" {
+			return out, fmt.Errorf("unsupported format %q", v)
+		}
+		out.format = v
+	}
+	return out, nil
+}
+
+// cacheKey identifies the output for `body` and `params`
+func (params renderParams) cacheKey(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("%s/%d/%d/%g/%v/%s", hex.EncodeToString(sum[:]),
+		params.width, params.height, params.scale, params.background, params.format)
+}
+
+func (s *server) handleRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	params, err := parseRenderParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	key := params.cacheKey(body)
+	if s.cache != nil {
+		if out, ok := s.cache.get(key); ok {
+			writeRendered(w, out, "hit")
+			return
+		}
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	case <-r.Context().Done(): // the client is gone
+		return
+	}
+	out, err := s.render(r.Context(), body, params)
+	<-s.slots
+	if err != nil {
+		if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+			return // the client is gone, there is no one to answer
+		}
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if s.cache != nil {
+		s.cache.add(key, out)
+	}
+	writeRendered(w, out, "miss")
+}
+
+func writeRendered(w http.ResponseWriter, out rendered, cacheStatus string) {
+	w.Header().Set("Content-Type", out.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(out.data)))
+	w.Header().Set("X-Cache", cacheStatus)
+	w.Write(out.data)
+}
+
+// errorStatus returns the HTTP status reporting a rendering error
+func errorStatus(err error) int {
+	var limitErr gosvg.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func (s *server) render(ctx context.Context, body []byte, params renderParams) (rendered, error) {
+	opts := gosvg.Options{
+		Limits: gosvg.Limits{
+			MaxPixels:       s.cfg.MaxPixels,
+			MaxLayerBytes:   s.cfg.MaxLayerBytes,
+			MaxDepth:        s.cfg.MaxDepth,
+			MaxPathSegments: s.cfg.MaxPathSegments,
+			Timeout:         s.cfg.Timeout,
+		},
+		Width:  params.width,
+		Height: params.height,
+		Scale:  gosvg.Fl(params.scale),
+	}
+	img, err := gosvg.RenderWithOptions(ctx, bytes.NewReader(body), &opts)
+	if err != nil {
+		return rendered{}, err
+	}
+	img = flatten(img, params.background)
+
+	var buf bytes.Buffer
+	out := rendered{contentType: "image/" + params.format}
+	if params.format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = gosvg.EncodePNG(&buf, img, gosvg.ColorSpaceSRGB)
+	}
+	out.data = buf.Bytes()
+	return out, err
+}
+
+// flatten composes `img` over the `background` color
+func flatten(img image.Image, background color.NRGBA) image.Image {
+	if background.A == 0 {
+		return img
+	}
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(out, out.Rect, img, out.Rect.Min, draw.Over)
+	return out
+}
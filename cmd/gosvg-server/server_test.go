@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const square = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10">
+	<rect x="5" width="5" height="5" fill="red"/>
+</svg>`
+
+func post(t *testing.T, srv *httptest.Server, query, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/render"+query, "image/svg+xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func decodePNG(t *testing.T, resp *http.Response) image.Image {
+	t.Helper()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("unexpected status %d: %s", resp.StatusCode, msg)
+	}
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestRender(t *testing.T) {
+	srv := httptest.NewServer(newServer(defaultConfig).routes())
+	defer srv.Close()
+
+	img := decodePNG(t, post(t, srv, "?scale=4&background=blue", square))
+	if size := img.Bounds().Size(); size != image.Pt(40, 40) {
+		t.Fatalf("unexpected size %v", size)
+	}
+	if r, _, _, _ := img.At(30, 10).RGBA(); r != 0xffff {
+		t.Fatalf("expected a red pixel, got %v", img.At(30, 10))
+	}
+	if _, _, b, _ := img.At(10, 30).RGBA(); b != 0xffff {
+		t.Fatalf("expected the background, got %v", img.At(10, 30))
+	}
+
+	img = decodePNG(t, post(t, srv, "?width=20", square))
+	if size := img.Bounds().Size(); size != image.Pt(20, 20) {
+		t.Fatalf("unexpected size %v", size)
+	}
+
+	resp := post(t, srv, "?format=jpeg", square)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "image/jpeg" {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, ct)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	cfg := defaultConfig
+	cfg.MaxBodyBytes = 1000
+	cfg.MaxPixels = 100 * 100
+	srv := httptest.NewServer(newServer(cfg).routes())
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		query, body string
+		status      int
+	}{
+		{"?width=-1", square, http.StatusBadRequest},
+		{"?format=gif", square, http.StatusBadRequest},
+		{"?background=nocolor", square, http.StatusBadRequest},
+		{"", "<svg", http.StatusBadRequest},
+		{"", square + strings.Repeat(" ", 1000), http.StatusRequestEntityTooLarge},
+		{"?scale=20", square, http.StatusUnprocessableEntity},
+	} {
+		resp := post(t, srv, tt.query, tt.body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.query, tt.status, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+// failingReader returns an error other than a size limit
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestRenderBodyErrors(t *testing.T) {
+	s := newServer(defaultConfig)
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/render", failingReader{}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+}
+
+func TestRenderLimits(t *testing.T) {
+	cfg := defaultConfig
+	cfg.MaxPathSegments = 2
+	srv := httptest.NewServer(newServer(cfg).routes())
+	defer srv.Close()
+
+	resp := post(t, srv, "", square)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestRenderConcurrency(t *testing.T) {
+	cfg := defaultConfig
+	cfg.MaxRenderings = 1
+	s := newServer(cfg)
+	s.slots <- struct{}{} // a rendering is running
+
+	// the request waits until the client gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/render", strings.NewReader(square)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Body.Len() != 0 || rec.Header().Get("X-Cache") != "" {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body)
+	}
+
+	// and is served once the slot is free
+	<-s.slots
+	rec = httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/render", strings.NewReader(square)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+}
+
+func TestRenderTimeout(t *testing.T) {
+	cfg := defaultConfig
+	cfg.Timeout = time.Nanosecond
+	srv := httptest.NewServer(newServer(cfg).routes())
+	defer srv.Close()
+
+	resp := post(t, srv, "", square)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestRenderCache(t *testing.T) {
+	srv := httptest.NewServer(newServer(defaultConfig).routes())
+	defer srv.Close()
+
+	var bodies [2][]byte
+	for i, exp := range []string{"miss", "hit"} {
+		resp := post(t, srv, "?scale=2", square)
+		if got := resp.Header.Get("X-Cache"); got != exp {
+			t.Fatalf("request %d: expected cache %s, got %s", i, exp, got)
+		}
+		bodies[i], _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if !bytes.Equal(bodies[0], bodies[1]) {
+		t.Fatal("cached image differs")
+	}
+	// the options are part of the key
+	resp := post(t, srv, "?scale=3", square)
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Cache"); got != "miss" {
+		t.Fatalf("expected cache miss, got %s", got)
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	c := newImageCache(10)
+	c.add("a", rendered{data: make([]byte, 4)})
+	c.add("b", rendered{data: make([]byte, 4)})
+	c.get("a") // b is now the least recently used
+	c.add("c", rendered{data: make([]byte, 4)})
+	if _, ok := c.get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Fatalf("expected %s to be cached", key)
+		}
+	}
+	c.add("big", rendered{data: make([]byte, 11)})
+	if c.images.Len() != 2 {
+		t.Fatalf("unexpected entries %d", c.images.Len())
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv := httptest.NewServer(newServer(defaultConfig).routes())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,215 @@
+package gosvg
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/benoitkugler/webrender/css/parser"
+)
+
+// ColorSpace is the color space of the pixels of the output.
+// The colors of the SVG documents and of the embedded
+// images are assumed to be sRGB, and are converted to the target
+// color space, where the compositing and the interpolation of
+// the gradients happen.
+// Use EncodePNG to tag the output with its color space.
+type ColorSpace uint8
+
+const (
+	// ColorSpaceSRGB is the default: the colors are not converted.
+	ColorSpaceSRGB ColorSpace = iota
+	// ColorSpaceDisplayP3 uses the wide gamut primaries of the DCI-P3
+	// color space, with the D65 white point and the sRGB transfer curve.
+	ColorSpaceDisplayP3
+	// ColorSpaceLinearSRGB uses the sRGB primaries with a linear transfer curve.
+	// Note that 8 bits are not enough to avoid banding in the dark tones.
+	ColorSpaceLinearSRGB
+)
+
+// chromaticities are the CIE xy coordinates of the primaries and
+// white point of a color space
+type chromaticities struct {
+	white, red, green, blue [2]float64
+}
+
+var (
+	srgbChromaticities = chromaticities{
+		white: [2]float64{0.3127, 0.3290},
+		red:   [2]float64{0.64, 0.33},
+		green: [2]float64{0.30, 0.60},
+		blue:  [2]float64{0.15, 0.06},
+	}
+	displayP3Chromaticities = chromaticities{
+		white: [2]float64{0.3127, 0.3290},
+		red:   [2]float64{0.680, 0.320},
+		green: [2]float64{0.265, 0.690},
+		blue:  [2]float64{0.150, 0.060},
+	}
+)
+
+func (cs ColorSpace) chromaticities() chromaticities {
+	if cs == ColorSpaceDisplayP3 {
+		return displayP3Chromaticities
+	}
+	return srgbChromaticities
+}
+
+// isLinear returns true if the transfer curve is the identity
+func (cs ColorSpace) isLinear() bool { return cs == ColorSpaceLinearSRGB }
+
+type matrix3 [3][3]float64
+
+func (m matrix3) mul(n matrix3) (out matrix3) {
+	for i := range out {
+		for j := range out[i] {
+			for k := 0; k < 3; k++ {
+				out[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return out
+}
+
+func (m matrix3) apply(v [3]float64) (out [3]float64) {
+	for i := range out {
+		out[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+	}
+	return out
+}
+
+func (m matrix3) invert() matrix3 {
+	a, b, c := m[0][0], m[0][1], m[0][2]
+	d, e, f := m[1][0], m[1][1], m[1][2]
+	g, h, i := m[2][0], m[2][1], m[2][2]
+	det := a*(e*i-f*h) - b*(d*i-f*g) + c*(d*h-e*g)
+	return matrix3{
+		{(e*i - f*h) / det, (c*h - b*i) / det, (b*f - c*e) / det},
+		{(f*g - d*i) / det, (a*i - c*g) / det, (c*d - a*f) / det},
+		{(d*h - e*g) / det, (b*g - a*h) / det, (a*e - b*d) / det},
+	}
+}
+
+// xyToXYZ returns the XYZ coordinates of the chromaticity (x, y), with Y = 1
+func xyToXYZ(xy [2]float64) [3]float64 {
+	return [3]float64{xy[0] / xy[1], 1, (1 - xy[0] - xy[1]) / xy[1]}
+}
+
+// toXYZ returns the matrix converting linear RGB values to XYZ
+func (ch chromaticities) toXYZ() matrix3 {
+	r, g, b := xyToXYZ(ch.red), xyToXYZ(ch.green), xyToXYZ(ch.blue)
+	primaries := matrix3{
+		{r[0], g[0], b[0]},
+		{r[1], g[1], b[1]},
+		{r[2], g[2], b[2]},
+	}
+	// scale the primaries so that (1, 1, 1) is the white point
+	s := primaries.invert().apply(xyToXYZ(ch.white))
+	for i := range primaries {
+		for j := range primaries[i] {
+			primaries[i][j] *= s[j]
+		}
+	}
+	return primaries
+}
+
+// srgbToLinear is the sRGB transfer function
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB is the inverse of srgbToLinear
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// fromSRGB returns the matrix converting linear sRGB values
+// to the linear values of the color space
+func (cs ColorSpace) fromSRGB() matrix3 {
+	return cs.chromaticities().toXYZ().invert().mul(srgbChromaticities.toXYZ())
+}
+
+// converter returns the function converting sRGB components in [0, 1]
+// to the color space, or nil for sRGB
+func (cs ColorSpace) converter() func(r, g, b float64) (float64, float64, float64) {
+	if cs == ColorSpaceSRGB {
+		return nil
+	}
+	m := cs.fromSRGB()
+	return func(r, g, b float64) (float64, float64, float64) {
+		lin := m.apply([3]float64{srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)})
+		for i, v := range lin {
+			v = math.Max(0, math.Min(1, v)) // clip out of gamut colors
+			if !cs.isLinear() {
+				v = linearToSRGB(v)
+			}
+			lin[i] = v
+		}
+		return lin[0], lin[1], lin[2]
+	}
+}
+
+// convert returns the sRGB color `c` in the color space
+func (cs ColorSpace) convert(c parser.RGBA) parser.RGBA {
+	conv := cs.converter()
+	if conv == nil {
+		return c
+	}
+	r, g, b := conv(float64(c.R), float64(c.G), float64(c.B))
+	return parser.RGBA{R: Fl(r), G: Fl(g), B: Fl(b), A: c.A}
+}
+
+// convertColors returns a converted copy of `colors`
+func (cs ColorSpace) convertColors(colors []parser.RGBA) []parser.RGBA {
+	if cs == ColorSpaceSRGB {
+		return colors
+	}
+	out := make([]parser.RGBA, len(colors))
+	for i, c := range colors {
+		out[i] = cs.convert(c)
+	}
+	return out
+}
+
+// convertImage returns the sRGB image `img` in the color space
+func (cs ColorSpace) convertImage(img image.Image) image.Image {
+	conv := cs.converter()
+	if conv == nil {
+		return img
+	}
+	bounds := img.Bounds()
+	out, ok := img.(*image.NRGBA)
+	if !ok {
+		out = image.NewNRGBA(bounds)
+		draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+	} else {
+		out = &image.NRGBA{Pix: append([]uint8(nil), out.Pix...), Stride: out.Stride, Rect: out.Rect}
+	}
+	// cache the conversions, since images usually have few distinct colors
+	cache := make(map[color.NRGBA]color.NRGBA)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := out.NRGBAAt(x, y)
+			key := color.NRGBA{R: c.R, G: c.G, B: c.B}
+			converted, ok := cache[key]
+			if !ok {
+				r, g, b := conv(float64(c.R)/0xff, float64(c.G)/0xff, float64(c.B)/0xff)
+				converted = color.NRGBA{R: unitToByte(r), G: unitToByte(g), B: unitToByte(b)}
+				cache[key] = converted
+			}
+			converted.A = c.A
+			out.SetNRGBA(x, y, converted)
+		}
+	}
+	return out
+}
+
+// unitToByte maps [0, 1] to [0, 255]
+func unitToByte(v float64) uint8 { return uint8(v*0xff + 0.5) }
@@ -0,0 +1,71 @@
+package gosvg
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/benoitkugler/webrender/css/parser"
+)
+
+func TestColorSpaceConvert(t *testing.T) {
+	for _, tt := range []struct {
+		cs      ColorSpace
+		in, exp parser.RGBA
+	}{
+		{ColorSpaceSRGB, parser.RGBA{R: 0.3, G: 0.2, B: 0.1, A: 0.5}, parser.RGBA{R: 0.3, G: 0.2, B: 0.1, A: 0.5}},
+		{ColorSpaceDisplayP3, parser.RGBA{R: 1, G: 1, B: 1, A: 1}, parser.RGBA{R: 1, G: 1, B: 1, A: 1}},
+		{ColorSpaceDisplayP3, parser.RGBA{A: 0.5}, parser.RGBA{A: 0.5}},
+		{ColorSpaceDisplayP3, parser.RGBA{R: 1, A: 1}, parser.RGBA{R: 0.9175, G: 0.2003, B: 0.1387, A: 1}},
+		{ColorSpaceLinearSRGB, parser.RGBA{R: 0.5, G: 1, A: 0.2}, parser.RGBA{R: 0.2140, G: 1, A: 0.2}},
+	} {
+		got := tt.cs.convert(tt.in)
+		for i, v := range [4]Fl{got.R - tt.exp.R, got.G - tt.exp.G, got.B - tt.exp.B, got.A - tt.exp.A} {
+			if math.Abs(float64(v)) > 1e-3 {
+				t.Fatalf("space %d: %v converted to %v, expected %v (channel %d)", tt.cs, tt.in, got, tt.exp, i)
+			}
+		}
+	}
+}
+
+func TestConvertImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 0xff, A: 0xff})
+	img.SetRGBA(1, 0, color.RGBA{R: 0x80, A: 0x80}) // premultiplied
+
+	if out := ColorSpaceSRGB.convertImage(img); out != image.Image(img) {
+		t.Fatal("sRGB images should not be converted")
+	}
+	out := ColorSpaceDisplayP3.convertImage(img).(*image.NRGBA)
+	if c := out.NRGBAAt(0, 0); c != (color.NRGBA{R: 234, G: 51, B: 35, A: 0xff}) {
+		t.Fatalf("unexpected color %v", c)
+	}
+	if c := out.NRGBAAt(1, 0); c != (color.NRGBA{R: 234, G: 51, B: 35, A: 0x80}) {
+		t.Fatalf("unexpected color %v", c)
+	}
+	if img.RGBAAt(0, 0).R != 0xff {
+		t.Fatal("the source image should not be modified")
+	}
+}
+
+func TestRenderColorSpace(t *testing.T) {
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10" fill="red"/></svg>`
+	for _, tt := range []struct {
+		cs  ColorSpace
+		exp color.RGBA
+	}{
+		{ColorSpaceSRGB, color.RGBA{R: 0xff, A: 0xff}},
+		{ColorSpaceDisplayP3, color.RGBA{R: 234, G: 51, B: 35, A: 0xff}},
+	} {
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(svg), &Options{ColorSpace: tt.cs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := img.(*image.RGBA).RGBAAt(5, 5); colorDistance(c, tt.exp) > 1 {
+			t.Fatalf("space %d: expected %v, got %v", tt.cs, tt.exp, c)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package gosvg
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/benoitkugler/textlayout/fonts"
+	"github.com/benoitkugler/webrender/css/parser"
+)
+
+// foregroundPaletteIndex is used by the layers
+// painted with the current fill color
+const foregroundPaletteIndex = 0xFFFF
+
+var errInvalidColorTable = errors.New("invalid color table")
+
+// colrLayer is one outline of a color glyph
+type colrLayer struct {
+	glyph        fonts.GID
+	paletteIndex uint16
+}
+
+// colrTable stores the layered glyphs of the version 0 of the COLR table.
+// The paint graphs added by the version 1 are not supported: the glyphs
+// only defined there are drawn with their outline.
+type colrTable struct {
+	baseGlyphs []colrBaseGlyph // sorted by glyph
+	layers     []colrLayer
+}
+
+type colrBaseGlyph struct {
+	glyph       fonts.GID
+	first, size uint16 // in layers
+}
+
+func parseCOLR(data []byte) (out colrTable, err error) {
+	if len(data) < 14 {
+		return out, errInvalidColorTable
+	}
+	numBase := int(binary.BigEndian.Uint16(data[2:]))
+	baseOffset := int(binary.BigEndian.Uint32(data[4:]))
+	layersOffset := int(binary.BigEndian.Uint32(data[8:]))
+	numLayers := int(binary.BigEndian.Uint16(data[12:]))
+	if baseOffset+6*numBase > len(data) || layersOffset+4*numLayers > len(data) {
+		return out, errInvalidColorTable
+	}
+
+	out.baseGlyphs = make([]colrBaseGlyph, numBase)
+	for i := range out.baseGlyphs {
+		record := data[baseOffset+6*i:]
+		out.baseGlyphs[i] = colrBaseGlyph{
+			glyph: fonts.GID(binary.BigEndian.Uint16(record)),
+			first: binary.BigEndian.Uint16(record[2:]),
+			size:  binary.BigEndian.Uint16(record[4:]),
+		}
+		if int(out.baseGlyphs[i].first)+int(out.baseGlyphs[i].size) > numLayers {
+			return colrTable{}, errInvalidColorTable
+		}
+	}
+	// the records should already be sorted
+	sort.SliceStable(out.baseGlyphs, func(i, j int) bool { return out.baseGlyphs[i].glyph < out.baseGlyphs[j].glyph })
+
+	out.layers = make([]colrLayer, numLayers)
+	for i := range out.layers {
+		record := data[layersOffset+4*i:]
+		out.layers[i] = colrLayer{
+			glyph:        fonts.GID(binary.BigEndian.Uint16(record)),
+			paletteIndex: binary.BigEndian.Uint16(record[2:]),
+		}
+	}
+	return out, nil
+}
+
+// glyphLayers returns the layers of `glyph`, from bottom to top,
+// or nil if it is not a color glyph
+func (t colrTable) glyphLayers(glyph fonts.GID) []colrLayer {
+	i := sort.Search(len(t.baseGlyphs), func(i int) bool { return t.baseGlyphs[i].glyph >= glyph })
+	if i == len(t.baseGlyphs) || t.baseGlyphs[i].glyph != glyph {
+		return nil
+	}
+	base := t.baseGlyphs[i]
+	return t.layers[base.first : base.first+base.size]
+}
+
+// parseCPAL returns the first palette of the CPAL table
+func parseCPAL(data []byte) ([]parser.RGBA, error) {
+	if len(data) < 14 {
+		return nil, errInvalidColorTable
+	}
+	numEntries := int(binary.BigEndian.Uint16(data[2:]))
+	numPalettes := int(binary.BigEndian.Uint16(data[4:]))
+	numRecords := int(binary.BigEndian.Uint16(data[6:]))
+	recordsOffset := int(binary.BigEndian.Uint32(data[8:]))
+	if numPalettes == 0 {
+		return nil, nil
+	}
+	first := int(binary.BigEndian.Uint16(data[12:]))
+	if first+numEntries > numRecords || recordsOffset+4*numRecords > len(data) {
+		return nil, errInvalidColorTable
+	}
+	out := make([]parser.RGBA, numEntries)
+	for i := range out {
+		record := data[recordsOffset+4*(first+i):] // BGRA, not premultiplied
+		out[i] = parser.RGBA{R: Fl(record[2]) / 0xff, G: Fl(record[1]) / 0xff, B: Fl(record[0]) / 0xff, A: Fl(record[3]) / 0xff}
+	}
+	return out, nil
+}
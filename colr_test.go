@@ -0,0 +1,74 @@
+package gosvg
+
+import (
+	"testing"
+
+	"github.com/benoitkugler/webrender/css/parser"
+)
+
+func TestParseCOLR(t *testing.T) {
+	table := []byte{
+		0, 0, // version
+		0, 2, // base glyphs
+		0, 0, 0, 14, // base glyphs offset
+		0, 0, 0, 26, // layers offset
+		0, 3, // layers
+		// base glyphs
+		0, 5, 0, 0, 0, 2,
+		0, 7, 0, 2, 0, 1,
+		// layers
+		0, 10, 0, 1,
+		0, 11, 0xFF, 0xFF,
+		0, 12, 0, 0,
+	}
+	colr, err := parseCOLR(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layers := colr.glyphLayers(5); len(layers) != 2 || layers[0] != (colrLayer{10, 1}) || layers[1] != (colrLayer{11, foregroundPaletteIndex}) {
+		t.Fatalf("unexpected layers %v", layers)
+	}
+	if layers := colr.glyphLayers(7); len(layers) != 1 || layers[0] != (colrLayer{12, 0}) {
+		t.Fatalf("unexpected layers %v", layers)
+	}
+	if layers := colr.glyphLayers(6); layers != nil {
+		t.Fatalf("unexpected layers %v", layers)
+	}
+
+	for _, invalid := range [][]byte{
+		nil,
+		table[:20],
+		append(append([]byte(nil), table[:25]...), 0, 0, 0, 4, 0, 1), // out of bounds layers
+	} {
+		if _, err := parseCOLR(invalid); err == nil {
+			t.Fatalf("expected error for %v", invalid)
+		}
+	}
+}
+
+func TestParseCPAL(t *testing.T) {
+	table := []byte{
+		0, 0, // version
+		0, 2, // entries per palette
+		0, 2, // palettes
+		0, 4, // color records
+		0, 0, 0, 16, // records offset
+		0, 0, 0, 2, // first records of the palettes
+		// BGRA records
+		0, 0, 0xFF, 0xFF,
+		0xFF, 0, 0, 0x80,
+		0, 0xFF, 0, 0xFF,
+		0, 0, 0, 0,
+	}
+	palette, err := parseCPAL(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(palette) != 2 || palette[0] != (parser.RGBA{R: 1, A: 1}) || palette[1] != (parser.RGBA{B: 1, A: Fl(0x80) / 0xff}) {
+		t.Fatalf("unexpected palette %v", palette)
+	}
+
+	if _, err := parseCPAL(table[:18]); err == nil {
+		t.Fatal("expected error for truncated table")
+	}
+}
@@ -0,0 +1,197 @@
+// Package compare quantifies the differences between two
+// renderings of the same image.
+//
+// The images are compared with their alpha-premultiplied,
+// 8 bits per channel RGBA values, alpha included.
+package compare
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Result summarizes the differences between two images.
+type Result struct {
+	// MaxDelta is the maximum difference of one channel.
+	MaxDelta uint8
+	// DifferentPixels is the number of pixels with at least one
+	// channel differing by more than the tolerance.
+	DifferentPixels int
+	// PSNR is the peak signal-to-noise ratio, in decibels,
+	// which is +Inf for identical images.
+	PSNR float64
+	// SSIM is the mean structural similarity index, averaged over the
+	// four channels, which is 1 for identical images.
+	SSIM float64
+}
+
+// Equal returns true if the images are identical.
+func (r Result) Equal() bool { return r.MaxDelta == 0 }
+
+func (r Result) String() string {
+	return fmt.Sprintf("max delta %d, %d different pixels, PSNR %.2f dB, SSIM %.4f",
+		r.MaxDelta, r.DifferentPixels, r.PSNR, r.SSIM)
+}
+
+// toRGBA returns the pixels of `img`, translated so that its
+// bounds start at (0, 0), without padding between the rows
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) && rgba.Stride == 4*b.Dx() {
+		return rgba
+	}
+	out := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.SetRGBA(x-b.Min.X, y-b.Min.Y, color.RGBAModel.Convert(img.At(x, y)).(color.RGBA))
+		}
+	}
+	return out
+}
+
+// pair returns `a` and `b` as RGBA images, or an error
+// if their sizes differ
+func pair(a, b image.Image) (*image.RGBA, *image.RGBA, error) {
+	if sa, sb := a.Bounds().Size(), b.Bounds().Size(); sa != sb {
+		return nil, nil, fmt.Errorf("compare: images have different sizes (%v and %v)", sa, sb)
+	}
+	return toRGBA(a), toRGBA(b), nil
+}
+
+// delta returns the maximum difference of the channels of the
+// pixels starting at `i`
+func delta(a, b *image.RGBA, i int) uint8 {
+	var max uint8
+	for c := i; c < i+4; c++ {
+		d := a.Pix[c] - b.Pix[c]
+		if a.Pix[c] < b.Pix[c] {
+			d = b.Pix[c] - a.Pix[c]
+		}
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// Compare returns the differences between `a` and `b`, which must have
+// the same size (their bounds may start at different points).
+// The pixels whose channels differ by at most `tolerance` are not counted
+// in Result.DifferentPixels, but are used by the other metrics.
+func Compare(a, b image.Image, tolerance uint8) (Result, error) {
+	ra, rb, err := pair(a, b)
+	if err != nil {
+		return Result{}, err
+	}
+	var (
+		out Result
+		sse float64 // sum of the squared errors
+	)
+	for i := 0; i < len(ra.Pix); i += 4 {
+		for c := i; c < i+4; c++ {
+			e := float64(ra.Pix[c]) - float64(rb.Pix[c])
+			sse += e * e
+		}
+		d := delta(ra, rb, i)
+		if d > out.MaxDelta {
+			out.MaxDelta = d
+		}
+		if d > tolerance {
+			out.DifferentPixels++
+		}
+	}
+	size := ra.Rect.Size()
+	out.PSNR = math.Inf(1)
+	if n := 4 * size.X * size.Y; sse > 0 && n > 0 {
+		mse := sse / float64(n)
+		out.PSNR = 10 * math.Log10(255*255/mse)
+	}
+	out.SSIM = ssim(ra, rb)
+	return out, nil
+}
+
+// the SSIM is computed on square windows of ssimWindow pixels,
+// every ssimStep pixels
+const (
+	ssimWindow = 8
+	ssimStep   = 4
+)
+
+// ssim returns the mean structural similarity of `a` and `b`,
+// which have the same size, starting at (0, 0).
+func ssim(a, b *image.RGBA) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	size := a.Rect.Size()
+	if size.X == 0 || size.Y == 0 {
+		return 1
+	}
+	// small images use one window
+	wx, wy := ssimWindow, ssimWindow
+	if size.X < wx {
+		wx = size.X
+	}
+	if size.Y < wy {
+		wy = size.Y
+	}
+	var (
+		total   float64
+		windows int
+	)
+	for y0 := 0; y0+wy <= size.Y; y0 += ssimStep {
+		for x0 := 0; x0+wx <= size.X; x0 += ssimStep {
+			for c := 0; c < 4; c++ {
+				var sa, sb, saa, sbb, sab float64
+				for y := y0; y < y0+wy; y++ {
+					for x := x0; x < x0+wx; x++ {
+						va, vb := float64(a.Pix[a.PixOffset(x, y)+c]), float64(b.Pix[b.PixOffset(x, y)+c])
+						sa += va
+						sb += vb
+						saa += va * va
+						sbb += vb * vb
+						sab += va * vb
+					}
+				}
+				n := float64(wx * wy)
+				ma, mb := sa/n, sb/n
+				va, vb := saa/n-ma*ma, sbb/n-mb*mb
+				cov := sab/n - ma*mb
+				total += ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			}
+			windows++
+		}
+	}
+	return total / float64(4*windows)
+}
+
+// Diff returns an image visualizing the differences between `a` and `b`,
+// which must have the same size: the pixels of `a` are shown in faded gray,
+// and the pixels differing by more than `tolerance` in red,
+// brighter for bigger differences.
+func Diff(a, b image.Image, tolerance uint8) (*image.RGBA, error) {
+	ra, rb, err := pair(a, b)
+	if err != nil {
+		return nil, err
+	}
+	out := image.NewRGBA(ra.Rect)
+	for i := 0; i < len(out.Pix); i += 4 {
+		if d := delta(ra, rb, i); d > tolerance {
+			out.Pix[i] = 128 + d/2
+			out.Pix[i+3] = 0xff
+			continue
+		}
+		// faded luminance over white
+		p := ra.Pix[i : i+4]
+		y := (299*uint32(p[0]) + 587*uint32(p[1]) + 114*uint32(p[2])) / 1000
+		if a := uint32(p[3]); y > a { // invalid premultiplied color
+			y = a
+		}
+		gray := uint8(0xff - (uint32(p[3])-y)/4)
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = gray, gray, gray, 0xff
+	}
+	return out, nil
+}
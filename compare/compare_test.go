@@ -0,0 +1,105 @@
+package compare
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func gradientImage(r image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(4 * x), G: uint8(4 * y), B: 0x80, A: 0xff})
+		}
+	}
+	return img
+}
+
+func TestCompareIdentical(t *testing.T) {
+	a := gradientImage(image.Rect(0, 0, 40, 30))
+	// the bounds may differ, and the pixels may be stored differently
+	b := image.NewNRGBA(image.Rect(10, 10, 50, 40))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			b.Set(x+10, y+10, a.At(x, y))
+		}
+	}
+	res, err := Compare(a, b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Equal() || res.DifferentPixels != 0 || !math.IsInf(res.PSNR, 1) || math.Abs(res.SSIM-1) > 1e-9 {
+		t.Fatalf("unexpected result %s", res)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a := gradientImage(image.Rect(0, 0, 40, 30))
+	b := gradientImage(image.Rect(0, 0, 40, 30))
+	b.SetRGBA(5, 5, color.RGBA{A: 0xff})                        // big difference
+	b.SetRGBA(6, 6, color.RGBA{R: 24, G: 25, B: 0x80, A: 0xff}) // small difference: (24, 24) expected
+
+	res, err := Compare(a, b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MaxDelta != 0x80 || res.DifferentPixels != 2 {
+		t.Fatalf("unexpected result %s", res)
+	}
+	if res.PSNR < 20 || res.PSNR > 60 || res.SSIM >= 1 || res.SSIM < 0.9 {
+		t.Fatalf("unexpected result %s", res)
+	}
+	if res, _ := Compare(a, b, 1); res.DifferentPixels != 1 {
+		t.Fatalf("unexpected result with tolerance %s", res)
+	}
+
+	// the metrics decrease with the differences
+	noisy := gradientImage(image.Rect(0, 0, 40, 30))
+	for i := 0; i < len(noisy.Pix); i += 12 {
+		noisy.Pix[i] ^= 0x40
+	}
+	res2, _ := Compare(a, noisy, 0)
+	if res2.PSNR >= res.PSNR || res2.SSIM >= res.SSIM {
+		t.Fatalf("unexpected result %s (compared to %s)", res2, res)
+	}
+
+	if _, err := Compare(a, image.NewRGBA(image.Rect(0, 0, 10, 10)), 0); err == nil {
+		t.Fatal("expected an error for different sizes")
+	}
+}
+
+func TestSSIMSmallImages(t *testing.T) {
+	a := gradientImage(image.Rect(0, 0, 3, 2))
+	res, err := Compare(a, a, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res.SSIM-1) > 1e-9 {
+		t.Fatalf("unexpected SSIM %g", res.SSIM)
+	}
+	empty := image.NewRGBA(image.Rectangle{})
+	if res, _ := Compare(empty, empty, 0); res.SSIM != 1 {
+		t.Fatalf("unexpected SSIM %g", res.SSIM)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := gradientImage(image.Rect(0, 0, 40, 30))
+	b := gradientImage(image.Rect(0, 0, 40, 30))
+	b.SetRGBA(5, 5, color.RGBA{A: 0xff})
+	diff, err := Diff(a, b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := diff.RGBAAt(5, 5); c.R < 128 || c.G != 0 || c.B != 0 {
+		t.Fatalf("expected a red pixel, got %v", c)
+	}
+	if c := diff.RGBAAt(10, 10); c.R != c.G || c.G != c.B || c.R < 0xc0 {
+		t.Fatalf("expected a light gray pixel, got %v", c)
+	}
+	if _, err := Diff(a, image.NewRGBA(image.Rect(0, 0, 10, 10)), 0); err == nil {
+		t.Fatal("expected an error for different sizes")
+	}
+}
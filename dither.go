@@ -0,0 +1,187 @@
+package gosvg
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/benoitkugler/webrender/css/parser"
+)
+
+// Dithering selects how the colors of the gradients are
+// quantized to the 8 bits of the output.
+// Dithering hides the banding of large, low contrast gradients,
+// at the cost of a slight noise.
+// The noise only depends on the position of the pixels, so that
+// the output is deterministic (and the same with tiles).
+type Dithering uint8
+
+const (
+	// DitherNone rounds the colors to the nearest value.
+	DitherNone Dithering = iota
+	// DitherOrdered uses the thresholds of a 8x8 Bayer matrix,
+	// which is cheap but produces a visible cross-hatch pattern.
+	DitherOrdered
+	// DitherBlueNoise uses the thresholds of a 64x64 blue noise texture,
+	// whose noise is less noticeable.
+	DitherBlueNoise
+)
+
+// bayer8 is the 8x8 Bayer matrix, with values in [0, 64)
+var bayer8 = [8][8]uint8{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// threshold returns the offset in [0, 1) added to the
+// pixel (x, y) before truncation
+func (d Dithering) threshold(x, y int) Fl {
+	switch d {
+	case DitherOrdered:
+		return (Fl(bayer8[y&7][x&7]) + 0.5) / 64
+	case DitherBlueNoise:
+		noise := blueNoise()
+		return (Fl(noise[y&(blueNoiseSize-1)][x&(blueNoiseSize-1)]) + 0.5) / (blueNoiseSize * blueNoiseSize)
+	default:
+		return 0.5
+	}
+}
+
+// quantize converts the color `c` of the pixel (x, y)
+func (d Dithering) quantize(c parser.RGBA, x, y int) color.NRGBA {
+	if d == DitherNone {
+		return toNRGBA(c)
+	}
+	th := d.threshold(x, y)
+	q := func(v Fl) uint8 {
+		v = v*0xff + th
+		if v <= 0 {
+			return 0
+		} else if v >= 0xff {
+			return 0xff
+		}
+		return uint8(v)
+	}
+	return color.NRGBA{R: q(c.R), G: q(c.G), B: q(c.B), A: q(c.A)}
+}
+
+// blueNoiseSize is the size of the blue noise texture,
+// which must be a power of 2
+const blueNoiseSize = 64
+
+var (
+	blueNoiseOnce    sync.Once
+	blueNoiseTexture *[blueNoiseSize][blueNoiseSize]uint16
+)
+
+// blueNoise returns the ranks of the pixels of
+// the blue noise texture, built on first use.
+func blueNoise() *[blueNoiseSize][blueNoiseSize]uint16 {
+	blueNoiseOnce.Do(func() { blueNoiseTexture = voidAndCluster() })
+	return blueNoiseTexture
+}
+
+// voidAndCluster builds a blue noise texture with the
+// void-and-cluster method of Ulichney.
+// The initial pattern uses a fixed seed, so that the texture is
+// always the same.
+func voidAndCluster() *[blueNoiseSize][blueNoiseSize]uint16 {
+	const (
+		n     = blueNoiseSize * blueNoiseSize
+		sigma = 1.5
+	)
+	// kernel[dy][dx] is the energy contribution at the (toroidal) offset (dx, dy)
+	var kernel [blueNoiseSize][blueNoiseSize]float64
+	for dy := range kernel {
+		for dx := range kernel[dy] {
+			ddx := math.Min(float64(dx), float64(blueNoiseSize-dx))
+			ddy := math.Min(float64(dy), float64(blueNoiseSize-dy))
+			kernel[dy][dx] = math.Exp(-(ddx*ddx + ddy*ddy) / (2 * sigma * sigma))
+		}
+	}
+
+	var (
+		pattern [n]bool
+		energy  [n]float64
+	)
+	toggle := func(p int, on bool) {
+		pattern[p] = on
+		px, py := p%blueNoiseSize, p/blueNoiseSize
+		sign := 1.
+		if !on {
+			sign = -1
+		}
+		for q := range energy {
+			dx := (q%blueNoiseSize - px) & (blueNoiseSize - 1)
+			dy := (q/blueNoiseSize - py) & (blueNoiseSize - 1)
+			energy[q] += sign * kernel[dy][dx]
+		}
+	}
+	// tightestCluster returns the pixel set with the highest energy,
+	// largestVoid the pixel unset with the lowest energy
+	tightestCluster := func() int {
+		best := -1
+		for p, on := range pattern {
+			if on && (best == -1 || energy[p] > energy[best]) {
+				best = p
+			}
+		}
+		return best
+	}
+	largestVoid := func() int {
+		best := -1
+		for p, on := range pattern {
+			if !on && (best == -1 || energy[p] < energy[best]) {
+				best = p
+			}
+		}
+		return best
+	}
+
+	// initial binary pattern, with 10% of the pixels set
+	rng := rand.New(rand.NewSource(1))
+	ones := 0
+	for _, p := range rng.Perm(n)[:n/10] {
+		toggle(p, true)
+		ones++
+	}
+	// spread the initial pattern
+	for {
+		cluster := tightestCluster()
+		toggle(cluster, false)
+		void := largestVoid()
+		toggle(void, true)
+		if void == cluster {
+			break
+		}
+	}
+	prototype, prototypeEnergy := pattern, energy
+
+	var ranks [n]int
+	// remove the pixels of the prototype, from the tightest clusters
+	for rank := ones - 1; rank >= 0; rank-- {
+		p := tightestCluster()
+		toggle(p, false)
+		ranks[p] = rank
+	}
+	// then fill the largest voids
+	pattern, energy = prototype, prototypeEnergy
+	for rank := ones; rank < n; rank++ {
+		p := largestVoid()
+		toggle(p, true)
+		ranks[p] = rank
+	}
+
+	var out [blueNoiseSize][blueNoiseSize]uint16
+	for p, rank := range ranks {
+		out[p/blueNoiseSize][p%blueNoiseSize] = uint16(rank)
+	}
+	return &out
+}
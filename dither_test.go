@@ -0,0 +1,138 @@
+package gosvg
+
+import (
+	"context"
+	"image"
+	"testing"
+
+	"github.com/benoitkugler/webrender/backend"
+	"github.com/benoitkugler/webrender/css/parser"
+)
+
+func TestBlueNoise(t *testing.T) {
+	noise := blueNoise()
+	seen := make([]bool, blueNoiseSize*blueNoiseSize)
+	for _, row := range noise {
+		for _, rank := range row {
+			if seen[rank] {
+				t.Fatalf("duplicate rank %d", rank)
+			}
+			seen[rank] = true
+		}
+	}
+
+	// the lowest thresholds are spread over the texture
+	const count = blueNoiseSize * blueNoiseSize / 16
+	var points []image.Point
+	for y, row := range noise {
+		for x, rank := range row {
+			if rank < count {
+				points = append(points, image.Pt(x, y))
+			}
+		}
+	}
+	dist := func(a, b int) int { // toroidal
+		d := a - b
+		if d < 0 {
+			d = -d
+		}
+		if blueNoiseSize-d < d {
+			d = blueNoiseSize - d
+		}
+		return d
+	}
+	for i, p := range points {
+		for _, q := range points[i+1:] {
+			if dx, dy := dist(p.X, q.X), dist(p.Y, q.Y); dx*dx+dy*dy < 4 {
+				t.Fatalf("thresholds %v and %v are too close", p, q)
+			}
+		}
+	}
+}
+
+// drawGradient draws `grad` on a new 128x128 image
+func drawGradient(grad backend.GradientLayout, dither Dithering) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	sess := newSession(context.Background(), Limits{})
+	sess.dither = dither
+	output := newCanvas(0, 0, 128, 128, img, nil, sess)
+	output.DrawGradient(grad, 128, 128)
+	return img
+}
+
+func TestDitherMean(t *testing.T) {
+	// a flat gradient, between two 8 bits values
+	gray := parser.RGBA{R: 128.25 / 255, G: 128.25 / 255, B: 128.25 / 255, A: 1}
+	grad := backend.GradientLayout{
+		Positions:    []Fl{0, 1},
+		Colors:       []parser.RGBA{gray, gray},
+		GradientKind: backend.GradientKind{Kind: "linear", Coords: [6]Fl{0, 0, 128, 0}},
+		ScaleY:       1,
+	}
+	for _, tt := range []struct {
+		dither Dithering
+		period int
+	}{
+		{DitherNone, 1},
+		{DitherOrdered, 8},
+		{DitherBlueNoise, blueNoiseSize},
+	} {
+		img := drawGradient(grad, tt.dither)
+		sum := 0
+		for y := 0; y < tt.period; y++ {
+			for x := 0; x < tt.period; x++ {
+				sum += int(img.RGBAAt(x, y).R)
+			}
+		}
+		mean := float64(sum) / float64(tt.period*tt.period)
+		exp := 128.25
+		if tt.dither == DitherNone {
+			exp = 128
+		}
+		if mean != exp {
+			t.Fatalf("dithering %d: expected mean %g, got %g", tt.dither, exp, mean)
+		}
+	}
+}
+
+func TestDitheredGradient(t *testing.T) {
+	stops := []parser.RGBA{{R: 0.2, G: 0.4, B: 0.6, A: 1}, {R: 0.3, G: 0.35, B: 0.5, A: 1}}
+	for _, kind := range []backend.GradientKind{
+		{Kind: "linear", Coords: [6]Fl{10, 20, 100, 90}},
+		{Kind: "radial", Coords: [6]Fl{64, 64, 0, 64, 64, 50}},
+		{Kind: "radial", Coords: [6]Fl{40, 50, 0, 64, 64, 50}},
+	} {
+		grad := backend.GradientLayout{
+			Positions:    []Fl{0.1, 0.9},
+			Colors:       stops,
+			GradientKind: kind,
+			ScaleY:       1,
+		}
+		// the colors only differ by the dithering
+		// (the pad colors are not compared, since rasterx does not
+		// correctly convert them)
+		ref, dithered := drawGradient(grad, DitherNone), drawGradient(grad, DitherOrdered)
+		param := gradientParam(grad)
+		for y := 0; y < 128; y++ {
+			for x := 0; x < 128; x++ {
+				if t := param(float64(x)+0.5, float64(y)+0.5); t <= 0.1 || t >= 0.9 {
+					continue
+				}
+				c1, c2 := ref.RGBAAt(x, y), dithered.RGBAAt(x, y)
+				if d := colorDistance(c1, c2); d > 2 {
+					t.Fatalf("%s, pixel (%d, %d): %v != %v", kind.Kind, x, y, c1, c2)
+				}
+			}
+		}
+	}
+}
+
+func TestDitherQuantize(t *testing.T) {
+	c := parser.RGBA{R: 1, G: 0, B: 0.5, A: 1}
+	for _, dither := range []Dithering{DitherNone, DitherOrdered, DitherBlueNoise} {
+		got := dither.quantize(c, 3, 5)
+		if got.R != 0xff || got.G != 0 || got.A != 0xff || (got.B != 0x7f && got.B != 0x80) {
+			t.Fatalf("dithering %d: unexpected color %v", dither, got)
+		}
+	}
+}
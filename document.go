@@ -0,0 +1,114 @@
+package gosvg
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/benoitkugler/webrender/svg"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// document is an SVG document, parsed once and shared by
+// the renderer, Inspect and the checks of the ignored features.
+// It is only read after parseDocument, so it may be used
+// concurrently.
+type document struct {
+	tree *html.Node // as read
+	root *html.Node // the <svg> element
+}
+
+// parseDocument parses `src`, which must contain an <svg> element
+func parseDocument(src io.Reader) (*document, error) {
+	tree, err := html.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	doc := &document{tree: tree}
+	doc.root = findRoot(tree)
+	if doc.root == nil {
+		return nil, errors.New("gosvg: missing <svg> element")
+	}
+	return doc, nil
+}
+
+// findRoot returns the first <svg> element of `tree`, or nil
+func findRoot(tree *html.Node) (root *html.Node) {
+	walk(tree, func(node *html.Node, depth int) bool {
+		if node.DataAtom == atom.Svg {
+			root = node
+		}
+		return root == nil
+	})
+	return root
+}
+
+// icon returns a drawable copy of the document
+func (doc *document) icon() (*svg.SVGImage, error) {
+	return svg.ParseNode(doc.tree, "", nil, nil)
+}
+
+// walk calls `fn` for the elements below `node`, in document
+// order, with their depth (1 for the children of `node`),
+// until `fn` returns false
+func walk(node *html.Node, fn func(node *html.Node, depth int) bool) {
+	var rec func(node *html.Node, depth int) bool
+	rec = func(node *html.Node, depth int) bool {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if !fn(child, depth) || !rec(child, depth+1) {
+				return false
+			}
+		}
+		return true
+	}
+	rec(node, 1)
+}
+
+// attribute returns the value of the attribute `name`
+// (without namespace) of `node`, or ""
+func attribute(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if attr.Namespace == "" && attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// elementProperties returns the attributes of `node`, where the declarations
+// of the style attribute override the presentation attributes.
+func elementProperties(node *html.Node) map[string]string {
+	out := make(map[string]string)
+	var style string
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" {
+			continue
+		}
+		if attr.Key == "style" {
+			style = attr.Val
+		} else {
+			out[attr.Key] = strings.TrimSpace(attr.Val)
+		}
+	}
+	for _, decl := range strings.Split(style, ";") {
+		if name, value, ok := cutDeclaration(decl); ok {
+			out[name] = strings.TrimSpace(strings.TrimSuffix(value, "!important"))
+		}
+	}
+	return out
+}
+
+// childrenText returns the concatenated text of the children of `node`
+func childrenText(node *html.Node) string {
+	var out strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			out.WriteString(child.Data)
+		}
+	}
+	return out.String()
+}
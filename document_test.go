@@ -0,0 +1,59 @@
+package gosvg
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// rootProperties returns the properties of the <svg> element of `content`
+func rootProperties(t *testing.T, content string) map[string]string {
+	t.Helper()
+	doc, err := parseDocument(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return elementProperties(doc.root)
+}
+
+func TestElementProperties(t *testing.T) {
+	props := rootProperties(t, `<?xml version="1.0"?>
+	<svg xmlns="http://www.w3.org/2000/svg" paint-order=" stroke " fill="red" style="fill: blue;; stroke : green">
+		<rect paint-order="fill" />
+	</svg>`)
+	for name, exp := range map[string]string{
+		"paint-order": "stroke",
+		"fill":        "blue",
+		"stroke":      "green",
+	} {
+		if got := props[name]; got != exp {
+			t.Fatalf("%s: expected %s, got %s", name, exp, got)
+		}
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	doc, err := parseDocument(strings.NewReader(`<?xml version="1.0"?><!-- comment -->
+	<svg viewBox="0 0 10 10"><g><rect id="r"/></g></svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.root.Data != "svg" || attribute(doc.root, "viewBox") != "0 0 10 10" {
+		t.Fatalf("unexpected root %v", doc.root)
+	}
+	var tags []string
+	walk(doc.root, func(elem *html.Node, depth int) bool {
+		tags = append(tags, strings.Repeat(" ", depth)+elem.Data)
+		return true
+	})
+	if got := strings.Join(tags, ","); got != " g,  rect" {
+		t.Fatalf("unexpected elements %q", got)
+	}
+
+	for _, src := range []string{"", "not an svg", "<html></html>"} {
+		if _, err := parseDocument(strings.NewReader(src)); err == nil {
+			t.Fatalf("expected error for %q", src)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package gosvg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing/fstest"
+
+	fc "github.com/benoitkugler/textlayout/fontconfig"
+	"github.com/benoitkugler/textlayout/pango/fcfonts"
+	"github.com/benoitkugler/webrender/css/properties"
+	"github.com/benoitkugler/webrender/css/validation"
+	"github.com/benoitkugler/webrender/text"
+	"github.com/benoitkugler/webrender/text/hyphen"
+	"github.com/benoitkugler/webrender/utils"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// FontConfig lists the fonts used to render the text.
+type FontConfig struct {
+	// Dirs are scanned recursively for font files.
+	Dirs []string
+	// FS, if not nil, provides more font files, like an embed.FS.
+	// Its files are scanned recursively, the ones which are not fonts
+	// being ignored. Font collections are not supported.
+	FS fs.FS
+	// SystemFonts adds the fonts installed on the system. It is disabled
+	// by default, so that the text is rendered the same way on every machine.
+	SystemFonts bool
+
+	// CacheFile, if not empty, stores the index of the fonts found in Dirs
+	// (and in the system directories), which is reused as long as the
+	// files are unchanged.
+	CacheFile string
+
+	// Fallback are the families used, in this order, for the characters
+	// not supported by the families of the text.
+	Fallback []string
+
+	// GlyphCacheSize is the maximum number of glyph outlines kept
+	// in memory, and shared by the renderings using the fonts.
+	// It defaults to 4096, a negative value disabling the cache.
+	GlyphCacheSize int
+	// CoverageCacheBytes, if positive, enables a cache of the rasterized
+	// glyphs, bounded to this size in bytes. Only the glyphs filled with
+	// a plain color and neither rotated nor skewed use it.
+	// Since the glyph positions are then rounded to a quarter of pixel,
+	// the output may differ slightly from the one without cache.
+	CoverageCacheBytes int64
+}
+
+// Fonts is an index of fonts, built by LoadFonts.
+// It is safe for concurrent use, and is meant to be
+// shared between renderings.
+type Fonts struct {
+	config   *fc.Config
+	database fc.Fontset // sorted by file, then index
+	// stores the faces and the content of the fonts of FontConfig.FS
+	memory *text.FontConfiguration
+
+	glyphs *glyphCache // may be nil
+}
+
+// LoadFonts scans the fonts of `config`.
+// The families of a text are resolved with the fontconfig rules
+// (with its usual aliases, like "sans-serif"), among the fonts of the index
+// only: for given files, the same fonts are always selected.
+func LoadFonts(config FontConfig) (*Fonts, error) {
+	out := &Fonts{
+		config: fc.Standard.Copy(),
+		glyphs: newGlyphCache(config.GlyphCacheSize, config.CoverageCacheBytes),
+	}
+
+	dirs := append([]string(nil), config.Dirs...)
+	if config.SystemFonts {
+		systemDirs, err := fc.DefaultFontDirs()
+		if err != nil {
+			return nil, fmt.Errorf("gosvg: loading fonts: %s", err)
+		}
+		dirs = append(dirs, systemDirs...)
+	}
+	database, err := out.scanDirs(dirs, config.CacheFile)
+	if err != nil {
+		return nil, fmt.Errorf("gosvg: loading fonts: %s", err)
+	}
+	sort.SliceStable(database, func(i, j int) bool {
+		fi, fj := database[i].FaceID(), database[j].FaceID()
+		return fi.File < fj.File || fi.File == fj.File && fi.Index < fj.Index
+	})
+
+	if len(config.Fallback) != 0 {
+		if err := out.config.LoadFromMemory(strings.NewReader(fallbackRule(config.Fallback))); err != nil {
+			return nil, fmt.Errorf("gosvg: invalid fallback fonts: %s", err)
+		}
+	}
+
+	out.memory = text.NewFontConfiguration(fcfonts.NewFontMap(out.config, database))
+	if config.FS != nil {
+		if err := out.addFS(config.FS); err != nil {
+			return nil, fmt.Errorf("gosvg: loading fonts: %s", err)
+		}
+	}
+	// the in-memory fonts have been added, with their rules
+	out.config, out.database = out.memory.Fontmap.Config, out.memory.Fontmap.Database
+	return out, nil
+}
+
+// fallbackRule returns a fontconfig rule appending `families`
+// to the families of every text
+func fallbackRule(families []string) string {
+	var rule strings.Builder
+	rule.WriteString(`<?xml version="1.0"?><fontconfig><match target="pattern"><edit name="family" mode="append_last">`)
+	for _, family := range families {
+		rule.WriteString("<string>" + escapeXML(family) + "</string>")
+	}
+	rule.WriteString("</edit></match></fontconfig>")
+	return rule.String()
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xmlEscaper.WriteString(&b, s)
+	return b.String()
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+// fontsCacheHeader starts the cache files, followed by the
+// fingerprint of the directories and the serialized font set
+const fontsCacheHeader = "gosvg-fonts-1"
+
+// scanDirs returns the fonts in `dirs`, using and updating `cacheFile` if not empty.
+func (f *Fonts) scanDirs(dirs []string, cacheFile string) (fc.Fontset, error) {
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+	if cacheFile == "" {
+		return f.config.ScanFontDirectories(dirs...)
+	}
+
+	fingerprint, err := dirsFingerprint(dirs)
+	if err != nil {
+		return nil, err
+	}
+	if database, ok := readFontsCache(cacheFile, fingerprint); ok {
+		return database, nil
+	}
+	database, err := f.config.ScanFontDirectories(dirs...)
+	if err != nil {
+		return nil, err
+	}
+	return database, writeFontsCache(cacheFile, fingerprint, database)
+}
+
+// dirsFingerprint identifies the files of `dirs`, by their
+// path, size and modification time
+func dirsFingerprint(dirs []string) (string, error) {
+	h := sha256.New()
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readFontsCache returns false if the cache is missing, invalid or outdated
+func readFontsCache(cacheFile, fingerprint string) (fc.Fontset, bool) {
+	file, err := os.Open(cacheFile)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	line, err := r.ReadString('\n')
+	if err != nil || line != fontsCacheHeader+" "+fingerprint+"\n" {
+		return nil, false
+	}
+	database, err := fc.LoadFontset(r)
+	return database, err == nil
+}
+
+func writeFontsCache(cacheFile, fingerprint string, database fc.Fontset) error {
+	var buf bytes.Buffer
+	buf.WriteString(fontsCacheHeader + " " + fingerprint + "\n")
+	if err := database.Serialize(&buf); err != nil {
+		return err
+	}
+	// replace the cache atomically, since it may be shared between processes
+	tmp, err := ioutil.TempFile(filepath.Dir(cacheFile), filepath.Base(cacheFile)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), cacheFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// memoryFontPrefix identifies the fonts of FontConfig.FS
+const memoryFontPrefix = "fs:"
+
+// addFS registers the fonts of `fsys`, as the @font-face rules of HTML documents.
+func (f *Fonts) addFS(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		url := memoryFontPrefix + path
+		patterns, err := f.memory.Fontmap.Config.ScanFontRessource(bytes.NewReader(content), url)
+		if err != nil { // not a font
+			return nil
+		}
+		if len(patterns) != 1 {
+			return fmt.Errorf("font collections are not supported (%s)", path)
+		}
+		descriptors, ok := fontFaceDescriptors(patterns[0])
+		if !ok {
+			return fmt.Errorf("missing font family (%s)", path)
+		}
+		descriptors.Src = []properties.NamedString{{Name: "external", String: url}}
+		fetcher := func(string) (utils.RemoteRessource, error) {
+			return utils.RemoteRessource{Content: bytes.NewReader(content)}, nil
+		}
+		if f.memory.AddFontFace(descriptors, fetcher) == "" {
+			return fmt.Errorf("invalid font (%s)", path)
+		}
+		return nil
+	})
+}
+
+// fontFaceDescriptors returns the descriptors matching the
+// scanned `pattern`, so that registering the font keeps its style.
+func fontFaceDescriptors(pattern fc.Pattern) (out validation.FontFaceDescriptors, ok bool) {
+	family, ok := pattern.GetString(fc.FAMILY)
+	if !ok {
+		return out, false
+	}
+	out.FontFamily = properties.String(family)
+
+	out.FontStyle = "normal"
+	if slant, _ := pattern.GetInt(fc.SLANT); slant == fc.SLANT_ITALIC {
+		out.FontStyle = "italic"
+	} else if slant == fc.SLANT_OBLIQUE {
+		out.FontStyle = "oblique"
+	}
+
+	out.FontWeight = properties.IntString{Int: 400}
+	if weight, ok := pattern.GetFloat(fc.WEIGHT); ok {
+		if ot := fc.WeightToOT(weight); ot > 0 {
+			// the CSS weights are multiples of 100
+			out.FontWeight.Int = int(math.Max(100, math.Min(900, 100*math.Round(float64(ot)/100))))
+		}
+	}
+
+	out.FontStretch = "normal"
+	if width, ok := pattern.GetInt(fc.WIDTH); ok {
+		out.FontStretch = properties.String(fontStretches[closestWidth(width)])
+	}
+	return out, true
+}
+
+// fontStretches maps the fontconfig widths to the CSS font-stretch values
+var fontStretches = map[int32]string{
+	50:  "ultra-condensed",
+	63:  "extra-condensed",
+	75:  "condensed",
+	87:  "semi-condensed",
+	100: "normal",
+	113: "semi-expanded",
+	125: "expanded",
+	150: "extra-expanded",
+	200: "ultra-expanded",
+}
+
+func closestWidth(width int32) int32 {
+	best := int32(100)
+	for w := range fontStretches {
+		if d, bestD := abs32(w-width), abs32(best-width); d < bestD || d == bestD && w < best {
+			best = w
+		}
+	}
+	return best
+}
+
+func abs32(a int32) int32 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// textContext is used by the SVG parser to lay out the text.
+// Since the font maps cache the loaded fonts, and are not safe
+// for concurrent use, one is created for each drawing.
+type textContext struct {
+	fonts   *text.FontConfiguration
+	hyphens map[text.HyphenDictKey]hyphen.Hyphener
+	struts  map[text.StrutLayoutKey][2]properties.Float
+}
+
+func (tc *textContext) Fonts() *text.FontConfiguration { return tc.fonts }
+
+func (tc *textContext) HyphenCache() map[text.HyphenDictKey]hyphen.Hyphener { return tc.hyphens }
+
+func (tc *textContext) StrutLayoutsCache() map[text.StrutLayoutKey][2]properties.Float {
+	return tc.struts
+}
+
+// newTextContext returns a context using the fonts of `f`,
+// which may be nil, meaning no fonts: the text is then laid out
+// with layoutFonts, and skipped by Canvas.DrawText.
+func (f *Fonts) newTextContext() (*textContext, error) {
+	out := &textContext{
+		hyphens: make(map[text.HyphenDictKey]hyphen.Hyphener),
+		struts:  make(map[text.StrutLayoutKey][2]properties.Float),
+	}
+	if f.isEmpty() {
+		var err error
+		if f, err = layoutFonts(); err != nil {
+			return nil, err
+		}
+	}
+	// share the in-memory fonts, which are not modified anymore
+	fonts := *f.memory
+	fonts.Fontmap = fcfonts.NewFontMap(f.config, f.database)
+	fonts.Fontmap.SetFaceLoader(&fonts)
+	out.fonts = &fonts
+	return out, nil
+}
+
+// isEmpty returns true if no text may be laid out with `f`,
+// which may be nil.
+func (f *Fonts) isEmpty() bool { return f == nil || len(f.database) == 0 }
+
+var layoutOnly struct {
+	once  sync.Once
+	fonts *Fonts
+	err   error
+}
+
+// layoutFonts returns the fonts used to lay out the text
+// when no fonts are configured, so that the documents are
+// processed the same way. The text is not drawn with them.
+// The embedded font is loaded on first use: the error, which
+// should not happen, is returned by all the calls.
+func layoutFonts() (*Fonts, error) {
+	layoutOnly.once.Do(func() {
+		layoutOnly.fonts, layoutOnly.err = LoadFonts(FontConfig{
+			FS:             fstest.MapFS{"goregular.ttf": {Data: goregular.TTF}},
+			GlyphCacheSize: -1,
+		})
+	})
+	return layoutOnly.fonts, layoutOnly.err
+}
@@ -0,0 +1,158 @@
+package gosvg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const emojiSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="100">
+	<text id="emoji" x="10" y="80" font-size="80" font-family="BabelStone Flags">🐯😀</text>
+</svg>`
+
+// countInk returns the number of non transparent pixels in `r`
+func countInk(img *image.RGBA, r image.Rectangle) int {
+	var out int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if img.RGBAAt(x, y).A != 0 {
+				out++
+			}
+		}
+	}
+	return out
+}
+
+func TestLoadFontsFS(t *testing.T) {
+	fonts, err := LoadFonts(FontConfig{
+		FS:       os.DirFS("testdata/fonts"),
+		Fallback: []string{"Noto Color Emoji", "Noto Color Emoji Sbix"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, warnings, err := RenderWithWarnings(context.Background(), strings.NewReader(emojiSVG), &Options{Fonts: fonts, Rasterizer: RasterizerCell})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	// the tiger and the smiley come from two different fallback fonts
+	rgba := img.(*image.RGBA)
+	if countInk(rgba, image.Rect(0, 0, 100, 100)) == 0 || countInk(rgba, image.Rect(100, 0, 200, 100)) == 0 {
+		t.Fatal("missing glyphs")
+	}
+
+	// the fonts are shared between the tiles
+	tiled, err := RenderWithOptions(context.Background(), strings.NewReader(emojiSVG), &Options{Fonts: fonts, Rasterizer: RasterizerCell, TileSize: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rgba.Pix, tiled.(*image.RGBA).Pix) {
+		t.Fatal("tiled rendering differs")
+	}
+}
+
+func TestFontsCache(t *testing.T) {
+	dir := t.TempDir()
+	fontDir := filepath.Join(dir, "fonts")
+	if err := os.Mkdir(fontDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"colr.ttf", "sbix.ttf"} {
+		content, err := ioutil.ReadFile("testdata/fonts/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(fontDir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := FontConfig{Dirs: []string{fontDir}, CacheFile: filepath.Join(dir, "fonts.cache")}
+
+	fonts, err := LoadFonts(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fonts.database) != 2 {
+		t.Fatalf("expected 2 fonts, got %d", len(fonts.database))
+	}
+	fingerprint, err := dirsFingerprint(config.Dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, ok := readFontsCache(config.CacheFile, fingerprint)
+	if !ok || len(cached) != 2 {
+		t.Fatal("cache file not written")
+	}
+
+	// the cache is reused, with the same result
+	fromCache, err := LoadFonts(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pattern := range fromCache.database {
+		if pattern.FaceID() != fonts.database[i].FaceID() {
+			t.Fatalf("font %d: expected %v, got %v", i, fonts.database[i].FaceID(), pattern.FaceID())
+		}
+	}
+
+	// and updated when the fonts change
+	if err := os.Remove(filepath.Join(fontDir, "sbix.ttf")); err != nil {
+		t.Fatal(err)
+	}
+	fonts, err = LoadFonts(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fonts.database) != 1 {
+		t.Fatalf("expected 1 font, got %d", len(fonts.database))
+	}
+	if _, ok := readFontsCache(config.CacheFile, fingerprint); ok {
+		t.Fatal("outdated cache file")
+	}
+}
+
+func TestRenderTextWithoutFonts(t *testing.T) {
+	for _, fonts := range []*Fonts{nil, {}} {
+		img, warnings, err := RenderWithWarnings(context.Background(), strings.NewReader(emojiSVG), &Options{Fonts: fonts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(warnings) != 1 || warnings[0].Feature != "text" {
+			t.Fatalf("unexpected warnings %v", warnings)
+		}
+		if n := countInk(img.(*image.RGBA), img.Bounds()); n != 0 {
+			t.Fatalf("unexpected %d drawn pixels", n)
+		}
+	}
+
+	// the text is still laid out, and rejected in strict mode
+	_, _, err := RenderWithWarnings(context.Background(), strings.NewReader(emojiSVG), &Options{Strict: true})
+	var w Warning
+	if !errors.As(err, &w) || w.Feature != "text" {
+		t.Fatalf("expected a warning as error, got %v", err)
+	}
+}
+
+func TestLayoutFonts(t *testing.T) {
+	// the embedded font is loaded once, without error
+	fonts, err := layoutFonts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fonts.isEmpty() {
+		t.Fatal("missing embedded font")
+	}
+	if other, _ := layoutFonts(); other != fonts {
+		t.Fatal("expected the fonts to be shared")
+	}
+}
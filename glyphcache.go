@@ -0,0 +1,298 @@
+package gosvg
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/benoitkugler/gosvg/internal/lru"
+	"github.com/benoitkugler/textlayout/fonts"
+	"github.com/benoitkugler/webrender/backend"
+	"github.com/benoitkugler/webrender/matrix"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/image/math/fixed"
+)
+
+// defaultGlyphCacheSize is the default of FontConfig.GlyphCacheSize
+const defaultGlyphCacheSize = 4096
+
+// glyphCache stores the outlines of the glyphs and, optionally,
+// their coverage, for all the renderings using the same Fonts.
+type glyphCache struct {
+	outlines *lru.Cache // of glyphOutline, one unit per glyph
+	coverage *lru.Cache // of *image.Alpha, by size in bytes; may be nil
+}
+
+// newGlyphCache returns nil if both caches are disabled
+func newGlyphCache(outlines int, coverageBytes int64) *glyphCache {
+	if outlines == 0 {
+		outlines = defaultGlyphCacheSize
+	}
+	if outlines < 0 && coverageBytes <= 0 {
+		return nil
+	}
+	out := new(glyphCache)
+	if outlines > 0 {
+		out.outlines = lru.New(int64(outlines))
+	}
+	if coverageBytes > 0 {
+		out.coverage = lru.New(coverageBytes)
+	}
+	return out
+}
+
+// faceKey identifies a font face, including its variation
+type faceKey struct {
+	id     fonts.FaceID
+	coords string // variable fonts only
+}
+
+func newFaceKey(id fonts.FaceID, face fonts.Face) faceKey {
+	out := faceKey{id: id}
+	if vf, ok := face.(interface{ VarCoordinates() []float32 }); ok {
+		coords := vf.VarCoordinates()
+		b := make([]byte, 0, 4*len(coords))
+		for _, c := range coords {
+			bits := math.Float32bits(c)
+			b = append(b, byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits))
+		}
+		out.coords = string(b)
+	}
+	return out
+}
+
+type outlineKey struct {
+	face  faceKey
+	glyph fonts.GID
+}
+
+// glyphOutline is the path of a glyph, in font units with the
+// y axis going up, which is immutable once cached.
+type glyphOutline struct {
+	path    path
+	fromSVG bool // the fallback outline of an SVG glyph
+	bitmap  bool // no outline: the glyph is a bitmap image
+}
+
+// outline returns the outline of `glyph`, extracted from the font
+// on first use.
+func (f *textFont) outline(glyph fonts.GID, ppem uint16) glyphOutline {
+	var outlines *lru.Cache
+	if f.glyphs != nil {
+		outlines = f.glyphs.outlines
+	}
+	key := outlineKey{f.key, glyph}
+	if outlines != nil {
+		if out, ok := outlines.Get(key); ok {
+			return out.(glyphOutline)
+		}
+	}
+
+	var out glyphOutline
+	switch data := f.face.GlyphData(glyph, ppem, ppem).(type) {
+	case fonts.GlyphOutline:
+		out.path = outlinePath(data)
+	case fonts.GlyphSVG:
+		out.path, out.fromSVG = outlinePath(data.Outline), true
+	case fonts.GlyphBitmap:
+		out.bitmap = true
+	}
+	if outlines != nil {
+		outlines.Add(key, out, 1)
+	}
+	return out
+}
+
+// outlinePath converts `outline`, closing the contours
+// so that they may be stroked.
+func outlinePath(outline fonts.GlyphOutline) path {
+	out := make(path, 0, len(outline.Segments)+4)
+	var current fonts.SegmentPoint
+	for i, seg := range outline.Segments {
+		switch seg.Op {
+		case fonts.SegmentOpMoveTo:
+			if i != 0 {
+				out = append(out, segment{op: closeOp})
+			}
+			out = append(out, newMoveTo(point{Fl(seg.Args[0].X), Fl(seg.Args[0].Y)}))
+			current = seg.Args[0]
+		case fonts.SegmentOpLineTo:
+			out = append(out, newLineTo(point{Fl(seg.Args[0].X), Fl(seg.Args[0].Y)}))
+			current = seg.Args[0]
+		case fonts.SegmentOpQuadTo:
+			// elevate to a cubic curve
+			c, to := seg.Args[0], seg.Args[1]
+			out = append(out, newCubeTo(
+				point{Fl(current.X + 2./3*(c.X-current.X)), Fl(current.Y + 2./3*(c.Y-current.Y))},
+				point{Fl(to.X + 2./3*(c.X-to.X)), Fl(to.Y + 2./3*(c.Y-to.Y))},
+				point{Fl(to.X), Fl(to.Y)}))
+			current = to
+		case fonts.SegmentOpCubeTo:
+			out = append(out, newCubeTo(
+				point{Fl(seg.Args[0].X), Fl(seg.Args[0].Y)},
+				point{Fl(seg.Args[1].X), Fl(seg.Args[1].Y)},
+				point{Fl(seg.Args[2].X), Fl(seg.Args[2].Y)}))
+			current = seg.Args[2]
+		}
+	}
+	if len(out) != 0 {
+		out = append(out, segment{op: closeOp})
+	}
+	return out
+}
+
+// subpixelSteps is the number of glyph positions cached
+// per pixel, along each axis
+const subpixelSteps = 4
+
+// coverageKey identifies the coverage of a glyph drawn at
+// one size and one subpixel position, with the rasterizer
+// of a session and the anti-aliasing of a state
+type coverageKey struct {
+	outline    outlineKey
+	a, d       float32 // the scales of the transform
+	dx, dy     uint8   // the subpixel position, in [0, subpixelSteps)
+	nonZero    bool
+	rasterizer Rasterizer
+	samples    int
+}
+
+// splitPosition returns the pixel containing `v`, and the
+// position of `v` in this pixel, rounded to a subpixel step
+func splitPosition(v Fl) (int, uint8) {
+	pixel := math.Floor(float64(v))
+	step := math.Round((float64(v) - pixel) * subpixelSteps)
+	if step == subpixelSteps {
+		pixel, step = pixel+1, 0
+	}
+	return int(pixel), uint8(step)
+}
+
+// fillGlyphCoverage fills `outline`, transformed by `mat`, with
+// the current fill color, using the coverage cache.
+// It returns false if the cache is disabled, or can't be used for
+// this glyph: the fill must be a plain color, and the transform
+// a scale and a translation.
+func (cv *Canvas) fillGlyphCoverage(font *textFont, glyph fonts.GID, outline glyphOutline, mat matrix.Transform, op backend.PaintOp) bool {
+	if font.glyphs == nil || font.glyphs.coverage == nil || mat.B != 0 || mat.C != 0 || cv.session.recordsShapes() {
+		return false
+	}
+	fill, ok := cv.state.fillColor.(plainColor)
+	if !ok {
+		return false
+	}
+	x, dx := splitPosition(mat.E)
+	y, dy := splitPosition(mat.F)
+	key := coverageKey{
+		outline: outlineKey{font.key, glyph}, a: mat.A, d: mat.D, dx: dx, dy: dy,
+		nonZero: op&backend.FillNonZero != 0, rasterizer: cv.session.rasterizerKind(), samples: cv.state.samples,
+	}
+	var mask *image.Alpha
+	if cached, ok := font.glyphs.coverage.Get(key); ok {
+		mask = cached.(*image.Alpha)
+	} else {
+		// account for the segments rasterized, as if the path was drawn
+		for _, seg := range outline.path {
+			if seg.op != closeOp && !cv.session.addSegment(cv.segments) {
+				return true
+			}
+		}
+		mat.E, mat.F = Fl(dx)/subpixelSteps, Fl(dy)/subpixelSteps
+		mask = cv.glyphMask(outline.path, mat, key.nonZero)
+		font.glyphs.coverage.Add(key, mask, int64(len(mask.Pix))+coverageEntrySize)
+	}
+
+	dst := cv.target(mask.Rect.Add(image.Pt(x, y)))
+	if dst == nil {
+		return true
+	}
+	r := dst.Rect.Intersect(mask.Rect.Add(image.Pt(x, y)))
+	sr, sg, sb, sa := fill.toRasterxColor().(color.Color).RGBA()
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		row := mask.Pix[mask.PixOffset(r.Min.X-x, py-y):]
+		pix := dst.Pix[dst.PixOffset(r.Min.X, py):]
+		for i := 0; i < r.Dx(); i++ {
+			if ma := uint32(row[i]) * 0x101; ma != 0 {
+				blendPixel(pix[4*i:4*i+4], sr, sg, sb, sa, ma)
+			}
+		}
+	}
+	return true
+}
+
+// coverageEntrySize approximates the memory used by
+// a cached coverage, besides its pixels
+const coverageEntrySize = 128
+
+// glyphMask rasterizes `p`, transformed by `mat`, with the
+// anti-aliasing of the current state, returning its coverage,
+// whose bounds are the pixels touched.
+func (cv *Canvas) glyphMask(p path, mat matrix.Transform, nonZero bool) *image.Alpha {
+	// find the extent of the path, then rasterize it in a
+	// scanner covering it, with a one pixel margin
+	var bounds boundsAdder
+	p.addTo(&bounds, mat, true)
+	r := bounds.rect()
+	if r.Empty() {
+		return image.NewAlpha(r)
+	}
+	r = r.Inset(-1)
+	mask := image.NewAlpha(r)
+
+	// the points are truncated when converted to fixed point:
+	// use positive coordinates, as when drawing into the output
+	shift := image.Pt(-r.Min.X, -r.Min.Y)
+	mat.E, mat.F = mat.E+Fl(shift.X), mat.F+Fl(shift.Y)
+	area := r.Add(shift)
+
+	sc := newScanner(area, cv.session, cv.state.samples)
+	if _, isGV := sc.(*gvScanner); isGV && !nonZero {
+		sc = newCellScanner(area, cv.session, 0) // see Canvas.fillerFor
+	}
+	filler := rasterx.NewFiller(area.Dx(), area.Dy(), sc)
+	filler.SetWinding(nonZero)
+	filler.SetColor(plainColor{R: 1, G: 1, B: 1, A: 1}.toRasterxColor())
+	p.addTo(filler, mat, true)
+	img := image.NewRGBA(area)
+	sc.setTarget(img)
+	sc.Draw()
+	filler.Clear()
+	for i := range mask.Pix {
+		mask.Pix[i] = img.Pix[4*i+3]
+	}
+	return mask
+}
+
+// boundsAdder is a rasterx.Adder computing the extent of
+// the control points of a path
+type boundsAdder struct {
+	extent  fixed.Rectangle26_6
+	started bool
+}
+
+func (b *boundsAdder) add(p fixed.Point26_6) {
+	if !b.started {
+		b.extent = fixed.Rectangle26_6{Min: p, Max: p}
+		b.started = true
+		return
+	}
+	if p.X < b.extent.Min.X {
+		b.extent.Min.X = p.X
+	}
+	if p.Y < b.extent.Min.Y {
+		b.extent.Min.Y = p.Y
+	}
+	if p.X > b.extent.Max.X {
+		b.extent.Max.X = p.X
+	}
+	if p.Y > b.extent.Max.Y {
+		b.extent.Max.Y = p.Y
+	}
+}
+
+func (b *boundsAdder) Start(a fixed.Point26_6)            { b.add(a) }
+func (b *boundsAdder) Line(a fixed.Point26_6)             { b.add(a) }
+func (b *boundsAdder) QuadBezier(a, c fixed.Point26_6)    { b.add(a); b.add(c) }
+func (b *boundsAdder) CubeBezier(a, c, d fixed.Point26_6) { b.add(a); b.add(c); b.add(d) }
+func (b *boundsAdder) Stop(closeLoop bool)                {}
+func (b *boundsAdder) rect() image.Rectangle              { return pixelBounds(b.extent) }
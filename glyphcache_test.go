@@ -0,0 +1,168 @@
+package gosvg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benoitkugler/textlayout/fonts"
+	"github.com/benoitkugler/webrender/backend"
+	"github.com/benoitkugler/webrender/css/parser"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestSplitPosition(t *testing.T) {
+	for _, test := range []struct {
+		v     Fl
+		pixel int
+		step  uint8
+	}{
+		{0, 0, 0},
+		{2.25, 2, 1},
+		{2.3, 2, 1},
+		{2.9, 3, 0},
+		{-0.25, -1, 3},
+	} {
+		if pixel, step := splitPosition(test.v); pixel != test.pixel || step != test.step {
+			t.Errorf("%g: expected %d %d, got %d %d", test.v, test.pixel, test.step, pixel, step)
+		}
+	}
+}
+
+// drawCachedGlyph draws `glyph` at (x, y), with a font size of 64,
+// using `cache`, which may be nil
+func drawCachedGlyph(font *testFont, content []byte, glyph fonts.GID, x, y Fl, cache *glyphCache) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	sess := newSession(context.Background(), Limits{})
+	sess.glyphs = cache
+	cv := newCanvas(0, 0, 100, 100, img, nil, sess)
+	cv.AddFont(font, content)
+	cv.state.SetColorRgba(parser.RGBA{R: 1, A: 1}, false)
+	cv.DrawText([]backend.TextDrawing{{
+		FontSize: 64, X: x, Y: y,
+		Runs: []backend.TextRun{{Font: font, Glyphs: []backend.TextGlyph{{Glyph: glyph}}}},
+	}})
+	return img
+}
+
+func TestGlyphCoverageCache(t *testing.T) {
+	font, content := loadTestFont(t, "colr.ttf")
+	cache := newGlyphCache(0, 1<<20)
+
+	// at a subpixel step, the positions are not rounded
+	for _, x := range []Fl{10, 10.25, 10.75} {
+		exp := drawCachedGlyph(font, content, 2, x, 70, nil)
+		for range [2]int{} { // the second drawing uses the cache
+			got := drawCachedGlyph(font, content, 2, x, 70, cache)
+			for i := range exp.Pix {
+				if d := int(exp.Pix[i]) - int(got.Pix[i]); d > 1 || d < -1 {
+					t.Fatalf("x=%g: unexpected pixel %d: %d instead of %d", x, i/4, got.Pix[i], exp.Pix[i])
+				}
+			}
+		}
+	}
+	if n := cache.coverage.Len(); n != 3 {
+		t.Fatalf("expected 3 cached glyphs, got %d", n)
+	}
+	if n := cache.outlines.Len(); n != 1 {
+		t.Fatalf("expected 1 cached outline, got %d", n)
+	}
+
+	// the rotated glyphs are not cached
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	sess := newSession(context.Background(), Limits{})
+	sess.glyphs = cache
+	cv := newCanvas(0, 0, 100, 100, img, nil, sess)
+	cv.DrawText([]backend.TextDrawing{{
+		FontSize: 64, X: 10, Y: 70, Angle: 0.1,
+		Runs: []backend.TextRun{{Font: font, Glyphs: []backend.TextGlyph{{Glyph: 2}}}},
+	}})
+	if n := cache.coverage.Len(); n != 3 {
+		t.Fatalf("expected 3 cached glyphs, got %d", n)
+	}
+
+	// the segments are only counted when rasterizing
+	for _, x := range []Fl{20, 10.5} { // the same subpixel position as x=10, then a new one
+		sess = newSession(context.Background(), Limits{})
+		sess.glyphs = cache
+		cv = newCanvas(0, 0, 100, 100, img, nil, sess)
+		cv.AddFont(font, content)
+		cv.state.SetColorRgba(parser.RGBA{R: 1, A: 1}, false)
+		cv.DrawText([]backend.TextDrawing{{
+			FontSize: 64, X: x, Y: 70,
+			Runs: []backend.TextRun{{Font: font, Glyphs: []backend.TextGlyph{{Glyph: 2}}}},
+		}})
+		if cached := x == 20; cached != (sess.segments == 0) {
+			t.Fatalf("x=%g: unexpected %d segments", x, sess.segments)
+		}
+	}
+}
+
+func TestGlyphCacheShapeRendering(t *testing.T) {
+	fonts, err := LoadFonts(FontConfig{FS: fstest.MapFS{"goregular.ttf": {Data: goregular.TTF}}, CoverageCacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same glyphs, at the same positions, with and without anti-aliasing
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="100" height="200">
+		<text x="10" y="70" font-size="60" font-family="Go">o</text>
+		<text x="10" y="170" font-size="60" font-family="Go" shape-rendering="crispEdges">o</text>
+	</svg>`
+	img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &Options{Fonts: fonts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba := img.(*image.RGBA)
+	smooth := countAntialiased(rgba.SubImage(image.Rect(0, 0, 100, 100)).(*image.RGBA))
+	crisp := countAntialiased(rgba.SubImage(image.Rect(0, 100, 100, 200)).(*image.RGBA))
+	if smooth == 0 || crisp != 0 || countInk(rgba, image.Rect(0, 100, 100, 200)) == 0 {
+		t.Fatalf("unexpected anti-aliased pixels: %d and %d", smooth, crisp)
+	}
+	if n := fonts.glyphs.coverage.Len(); n != 2 {
+		t.Fatalf("expected 2 cached glyphs, got %d", n)
+	}
+}
+
+func TestGlyphCacheConcurrent(t *testing.T) {
+	fonts, err := LoadFonts(FontConfig{FS: os.DirFS("testdata/fonts"), CoverageCacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="100">
+		<text x="5" y="70" font-size="60" font-family="BabelStone Flags" fill="teal">🏴🏴🏴</text>
+	</svg>`
+
+	var (
+		wg      sync.WaitGroup
+		outputs [8][]byte
+	)
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &Options{Fonts: fonts, Rasterizer: RasterizerCell, TileSize: 64})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			outputs[i] = img.(*image.RGBA).Pix
+		}(i)
+	}
+	wg.Wait()
+	if countInk(&image.RGBA{Pix: outputs[0], Stride: 4 * 200, Rect: image.Rect(0, 0, 200, 100)}, image.Rect(0, 0, 200, 100)) == 0 {
+		t.Fatal("missing glyphs")
+	}
+	for i := range outputs {
+		if !bytes.Equal(outputs[i], outputs[0]) {
+			t.Fatalf("rendering %d differs", i)
+		}
+	}
+	if fonts.glyphs.outlines.Len() == 0 || fonts.glyphs.coverage.Len() == 0 {
+		t.Fatal("glyphs not cached")
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/benoitkugler/webrender v0.0.2
 	github.com/srwiley/rasterx v0.0.0-20220128185129-2efea2b9ea41
 	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
+	golang.org/x/net v0.0.0-20211216030914-fe4d6282115f
 )
 
 replace github.com/benoitkugler/webrender => ../webrender
@@ -1,25 +1,232 @@
 package gosvg
 
 import (
+	"context"
+	"errors"
 	"image"
 	"io"
-
-	"github.com/benoitkugler/webrender/svg"
+	"sync/atomic"
 )
 
+// Options controls how an image is rendered.
+// The zero value is valid and renders without limits.
+type Options struct {
+	// Limits bounds the resources used by the rendering.
+	Limits Limits
+
+	// Width and Height, if positive, are the size of the output, in pixels.
+	// If only one of them is given, the other one follows the aspect
+	// ratio of the image.
+	// By default, the intrinsic size of the image is used: the width and
+	// height of the root element, in user units or any CSS absolute unit,
+	// the missing one following the aspect ratio of the viewBox.
+	// The size of the viewBox is used if none is given (or if they are
+	// percentages), and 600x600 pixels if there is no viewBox either.
+	// Fractional sizes are rounded to the nearest pixel, halves up,
+	// with at least one pixel for non empty images.
+	Width, Height int
+	// DPI is the resolution of the output, in pixels per inch, used to
+	// convert the intrinsic size of the image. It defaults to 96,
+	// for which one user unit (or CSS pixel) is one pixel.
+	DPI Fl
+	// Scale, if positive, multiplies the size of the output.
+	Scale Fl
+
+	// TileSize, if positive, splits the output into square tiles
+	// of TileSize pixels, rendered concurrently.
+	// It requires RasterizerCell (RasterizerGV depends on the area it
+	// rasterizes, so that the tiles would have seams), with which
+	// the result is exactly the same as without tiles.
+	// Since the whole image is processed for each tile, only big tiles
+	// (say, a few hundreds pixels) are worth it.
+	// The path segments are counted once for Limits.MaxPathSegments,
+	// but Limits.MaxLayerBytes bounds the layers of all the tiles
+	// rendered at the same time.
+	TileSize int
+	// TileWorkers is the maximum number of tiles rendered
+	// at the same time. It defaults to runtime.GOMAXPROCS(0).
+	TileWorkers int
+
+	// Antialiasing selects how the edges of the shapes are smoothed.
+	Antialiasing Antialiasing
+	// Samples is the number of samples per pixel, along each axis,
+	// used by AntialiasSupersample. It defaults to 4, and is at most 16.
+	Samples int
+	// Rasterizer selects the algorithm computing the coverage
+	// of the pixels (RasterizerGV by default).
+	Rasterizer Rasterizer
+
+	// PaintOrder, like "stroke" or "markers fill", overrides the
+	// paint-order property of all the elements.
+	PaintOrder string
+
+	// NonScalingStroke strokes all the shapes as if they had
+	// the vector-effect: non-scaling-stroke property: the geometry is
+	// transformed, but the stroke width and dashes are in output pixels.
+	// Otherwise, the property of each element is used.
+	NonScalingStroke bool
+
+	// Stroke exposes the joins, caps and gaps supported by the rasterizer.
+	Stroke StrokeOptions
+
+	// Dither selects the dithering of the gradients (none by default).
+	Dither Dithering
+	// Quantize, if not nil, converts the output to an *image.Gray
+	// or an *image.Paletted.
+	Quantize *Quantization
+
+	// DistanceFieldSpread, if positive, makes the output a *DistanceField,
+	// computed from the geometry of the filled and stroked shapes,
+	// with distances clamped to [-DistanceFieldSpread, DistanceFieldSpread] pixels.
+	// The paints, opacities, clips and masks, the dashes and the images
+	// are ignored, and the strokes have round joins and caps.
+	// Quantize and TileSize are ignored.
+	// Computing the field costs, for each pixel, one test per shape, and
+	// one per segment of the shapes closer than the spread: it is bounded
+	// by Limits.Timeout, not by Limits.MaxPathSegments.
+	DistanceFieldSpread Fl
+
+	// Fonts are used to draw the text elements, which are
+	// ignored (with a warning) if nil. See LoadFonts.
+	Fonts *Fonts
+
+	// ColorSpace is the color space of the output (sRGB by default).
+	// See EncodePNG to save the output with its color space.
+	ColorSpace ColorSpace
+
+	// Strict aborts the rendering on the first unsupported
+	// feature, returning a Warning as error.
+	Strict bool
+
+	// Trace, if not nil, records the operations of the rendering.
+	Trace *Trace
+}
+
+// Render is a shortcut for RenderWithOptions, without
+// cancellation nor options.
 func Render(src io.Reader) (image.Image, error) {
-	icon, err := svg.Parse(src, "", nil, nil)
+	return RenderWithOptions(context.Background(), src, nil)
+}
+
+// RenderWithOptions rasterizes the SVG image read from `src`.
+// The rendering is aborted if `ctx` is cancelled, or
+// if one of the limits in `opts` is exceeded.
+// `opts` may be nil to use the default options.
+func RenderWithOptions(ctx context.Context, src io.Reader, opts *Options) (image.Image, error) {
+	img, _, err := RenderWithWarnings(ctx, src, opts)
+	return img, err
+}
+
+// RenderWithWarnings is like RenderWithOptions, but also returns
+// the features of the image which have been ignored.
+func RenderWithWarnings(ctx context.Context, src io.Reader, opts *Options) (image.Image, []Warning, error) {
+	return render(ctx, src, opts, nil)
+}
+
+// render implements RenderWithWarnings, the memory of the output
+// and of the layers being accounted in `budget`, which may be nil.
+func render(ctx context.Context, src io.Reader, opts *Options, budget *memoryBudget) (image.Image, []Warning, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	if opts.Rasterizer == RasterizerFT && newFTScanner == nil {
+		return nil, nil, errors.New("gosvg: RasterizerFT requires the gosvg_ft build tag")
+	}
+	if opts.TileSize > 0 && opts.Rasterizer != RasterizerCell {
+		return nil, nil, errors.New("gosvg: Options.TileSize requires RasterizerCell")
+	}
+	if timeout := opts.Limits.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	doc, err := parseDocument(src)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	sess := newSession(ctx, opts.Limits)
+	root := elementProperties(doc.root)
+	sess.samples = opts.Antialiasing.samples(opts.Samples)
+	sess.shapeRendering = opts.Antialiasing == AntialiasAuto
+	sess.rasterizer = opts.Rasterizer
+	sess.paintOrder = parsePaintOrder(opts.PaintOrder)
+	sess.followPaintOrder = opts.PaintOrder == ""
+	sess.nonScalingStroke = opts.NonScalingStroke
+	sess.stroke = opts.strokeStyle()
+	sess.dither = opts.Dither
+	sess.colorSpace = opts.ColorSpace
+	sess.strict = opts.Strict
+	sess.distanceField = opts.DistanceFieldSpread > 0
+	sess.withoutFonts = opts.Fonts.isEmpty()
+	if opts.Fonts != nil {
+		sess.glyphs = opts.Fonts.glyphs
 	}
 
-	var width, height Fl = 600., 600.
-	if vb := icon.ViewBox(); vb != nil {
-		width, height = vb.Width, vb.Height
+	for _, w := range documentWarnings(doc) {
+		sess.warn(w)
 	}
-	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
-	output := newCanvas(0, 0, width, height, img, nil)
-	icon.Draw(output, width, height, nil)
 
-	return img, nil
+	icon, err := doc.icon()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sess.checkContext() {
+		return nil, nil, sess.error()
+	}
+
+	texts, err := opts.Fonts.newTextContext()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	layout, width, height := opts.outputLayout(root, icon)
+	if err := opts.Limits.checkOutputSize(width, height); err != nil {
+		return nil, nil, err
+	}
+	rect := layout.rect()
+	if err := budget.acquire(ctx, layerSize(rect)); err != nil {
+		return nil, nil, err
+	}
+	sess.budget = budget
+	defer func() {
+		// the layers not released, if any, are given back with the output
+		budget.release(layerSize(rect) + atomic.LoadInt64(&sess.layerBytes))
+	}()
+	// for a distance field, the shapes are only recorded, and the budget
+	// acquired for the output is used by the field (4 bytes per pixel too)
+	img := &image.RGBA{Rect: rect}
+	if !sess.distanceField {
+		img = image.NewRGBA(rect)
+	}
+
+	var output *Canvas
+	if opts.Trace != nil {
+		tr := newTracer(opts.Trace, sess)
+		var width, height Fl
+		output, width, height = layout.newCanvas(img, sess)
+		icon.Draw(tr.wrap(output), width, height, texts)
+		tr.close()
+	} else if opts.TileSize > 0 && !sess.distanceField {
+		renderTiles(doc, icon, texts, img, layout, sess, opts.Fonts, opts.TileSize, opts.TileWorkers)
+	} else {
+		var width, height Fl
+		output, width, height = layout.newCanvas(img, sess)
+		icon.Draw(output, width, height, texts)
+	}
+
+	if err := sess.error(); err != nil {
+		return nil, nil, err
+	}
+	if sess.distanceField {
+		field := newDistanceField(rect, output.shapes, opts.DistanceFieldSpread, sess)
+		if err := sess.error(); err != nil {
+			return nil, nil, err
+		}
+		return field, sess.getWarnings(), nil
+	}
+	if opts.Quantize != nil {
+		return opts.Quantize.apply(img), sess.getWarnings(), nil
+	}
+	return img, sess.getWarnings(), nil
 }
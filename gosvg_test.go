@@ -1,6 +1,8 @@
 package gosvg
 
 import (
+	"context"
+	"image"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,16 +29,49 @@ func renderIcon(t testing.TB, iconPath string) {
 	}
 }
 
-func TestLandscapeIcons(t *testing.T) {
-	for _, p := range []string{
-		"beach",
-		"cape", "iceberg", "island",
-		"mountains", "sea", "trees", "village",
-	} {
-		renderIcon(t, "testdata/landscapeIcons/"+p+".svg")
+// goldenIcons are rendered by TestLandscapeIcons, TestTestIcons
+// and TestStrokeIcons, and compared for each rasterizer
+var goldenIcons = []string{
+	"testdata/landscapeIcons/beach.svg",
+	"testdata/landscapeIcons/cape.svg",
+	"testdata/landscapeIcons/iceberg.svg",
+	"testdata/landscapeIcons/island.svg",
+	"testdata/landscapeIcons/mountains.svg",
+	"testdata/landscapeIcons/sea.svg",
+	"testdata/landscapeIcons/trees.svg",
+	"testdata/landscapeIcons/village.svg",
+
+	"testdata/testIcons/astronaut.svg",
+	"testdata/testIcons/jupiter.svg",
+	"testdata/testIcons/lander.svg",
+	"testdata/testIcons/school-bus.svg",
+	"testdata/testIcons/telescope.svg",
+	"testdata/testIcons/content-cut-light.svg",
+	"testdata/testIcons/defs.svg",
+	"testdata/testIcons/24px.svg",
+
+	"testdata/OpacityStrokeDashTest.svg",
+	"testdata/OpacityStrokeDashTest2.svg",
+	"testdata/OpacityStrokeDashTest3.svg",
+	"testdata/TestShapes.svg",
+	"testdata/TestShapes2.svg",
+	"testdata/TestShapes3.svg",
+	"testdata/TestShapes4.svg",
+	"testdata/TestShapes5.svg",
+	"testdata/TestShapes6.svg",
+}
+
+// renderIcons renders the golden icons in `dir`
+func renderIcons(t *testing.T, dir string) {
+	for _, p := range goldenIcons {
+		if filepath.Dir(p) == dir {
+			renderIcon(t, p)
+		}
 	}
 }
 
+func TestLandscapeIcons(t *testing.T) { renderIcons(t, "testdata/landscapeIcons") }
+
 func BenchmarkRaster(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		for _, p := range []string{
@@ -49,31 +84,9 @@ func BenchmarkRaster(b *testing.B) {
 	}
 }
 
-func TestTestIcons(t *testing.T) {
-	for _, p := range []string{
-		"astronaut", "jupiter", "lander", "school-bus", "telescope", "content-cut-light",
-		"defs",
-		"24px",
-	} {
-		renderIcon(t, "testdata/testIcons/"+p+".svg")
-	}
-}
+func TestTestIcons(t *testing.T) { renderIcons(t, "testdata/testIcons") }
 
-func TestStrokeIcons(t *testing.T) {
-	for _, p := range []string{
-		"OpacityStrokeDashTest.svg",
-		"OpacityStrokeDashTest2.svg",
-		"OpacityStrokeDashTest3.svg",
-		"TestShapes.svg",
-		"TestShapes2.svg",
-		"TestShapes3.svg",
-		"TestShapes4.svg",
-		"TestShapes5.svg",
-		"TestShapes6.svg",
-	} {
-		renderIcon(t, "testdata/"+p)
-	}
-}
+func TestStrokeIcons(t *testing.T) { renderIcons(t, "testdata") }
 
 // TODO: support text
 // func TestPercentagesAndText(t *testing.T) {
@@ -106,3 +119,26 @@ func TestMask(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestOutputSize(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 10"></svg>`
+	for _, tt := range []struct {
+		opts Options
+		exp  image.Point
+	}{
+		{Options{}, image.Pt(20, 10)},
+		{Options{Scale: 2.5}, image.Pt(50, 25)},
+		{Options{Width: 40}, image.Pt(40, 20)},
+		{Options{Height: 40}, image.Pt(80, 40)},
+		{Options{Width: 30, Height: 30}, image.Pt(30, 30)},
+		{Options{Width: 30, Scale: 2}, image.Pt(60, 30)},
+	} {
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := img.Bounds().Size(); got != tt.exp {
+			t.Fatalf("%+v: expected %v, got %v", tt.opts, tt.exp, got)
+		}
+	}
+}
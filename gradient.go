@@ -0,0 +1,231 @@
+package gosvg
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/benoitkugler/webrender/backend"
+	"github.com/benoitkugler/webrender/css/parser"
+	"github.com/srwiley/rasterx"
+)
+
+// gradientColorFunc returns the color function painting the linear,
+// radial or conic gradient `grad`, in absolute pixel coordinates, over a
+// rectangle of size (width, height).
+// Mesh gradients are rasterized with rasterizeMesh.
+func gradientColorFunc(grad backend.GradientLayout, width, height Fl, dither Dithering) rasterx.ColorFunc {
+	if grad.GradientKind.Kind == "conic" {
+		return conicGradient(grad, dither)
+	}
+	if dither != DitherNone {
+		return ditheredGradient(grad, dither)
+	}
+	rg := toRasterxGradient(grad, width, height)
+	return rg.GetColorFunction(1).(rasterx.ColorFunc)
+}
+
+// ditheredGradient returns the color function of a linear or radial gradient,
+// computing the colors as rasterx does (see toRasterxGradient), but without
+// the intermediate 8 bits quantization, so that they may be dithered
+func ditheredGradient(grad backend.GradientLayout, dither Dithering) rasterx.ColorFunc {
+	param := gradientParam(grad)
+	return func(x, y int) color.Color {
+		t := param(float64(x)+0.5, float64(y)+0.5)
+		return dither.quantize(stopColor(grad.Positions, grad.Colors, Fl(t), false), x, y)
+	}
+}
+
+// conicGradient returns the color function of a conic gradient,
+// whose positions are repeated if grad.Reapeating is true
+func conicGradient(grad backend.GradientLayout, dither Dithering) rasterx.ColorFunc {
+	cx, cy, start := float64(grad.Coords[0]), float64(grad.Coords[1]), float64(grad.Coords[2])
+	return func(x, y int) color.Color {
+		// angle of the pixel center, clockwise from the top (y points down)
+		angle := math.Atan2(float64(x)+0.5-cx, cy-float64(y)-0.5)
+		t := math.Mod((angle-start)/(2*math.Pi), 1)
+		if t < 0 {
+			t++
+		}
+		return dither.quantize(stopColor(grad.Positions, grad.Colors, Fl(t), grad.Reapeating), x, y)
+	}
+}
+
+// gradientParam returns the function mapping a point to its
+// position along a linear or radial gradient
+func gradientParam(grad backend.GradientLayout) func(x, y float64) float64 {
+	c := grad.Coords
+	scaleY := float64(grad.ScaleY)
+	if grad.GradientKind.Kind != "radial" {
+		p1x, p1y, p2x, p2y := float64(c[0]), scaleY*float64(c[1]), float64(c[2]), scaleY*float64(c[3])
+		dx, dy := p2x-p1x, p2y-p1y
+		d := dx*dx + dy*dy
+		return func(x, y float64) float64 {
+			return (dx*(x-p1x) + dy*(y-p1y)) / d
+		}
+	}
+
+	// the focal radius is ignored
+	fx, fy, cx, cy := float64(c[0]), scaleY*float64(c[1]), float64(c[3]), scaleY*float64(c[4])
+	rx, ry := float64(c[5]), scaleY*float64(c[5])
+	if cx == fx && cy == fy {
+		return func(x, y float64) float64 {
+			dx, dy := x-cx, y-cy
+			return math.Sqrt(dx*dx/(rx*rx) + dy*dy/(ry*ry))
+		}
+	}
+	fx, fy, cx, cy = fx/rx, fy/ry, cx/rx, cy/ry
+	if dfx, dfy := fx-cx, fy-cy; dfx*dfx+dfy*dfy > 1 {
+		// focus outside of the circle: use the intersection of the line
+		// from the center to the focus with the circle
+		const epsilon = 1e-5
+		fx, fy, _ = rasterx.RayCircleIntersectionF(fx, fy, cx, cy, cx, cy, 1-epsilon)
+	}
+	return func(x, y float64) float64 {
+		ex, ey := x/rx, y/ry
+		t1x, t1y, intersects := rasterx.RayCircleIntersectionF(ex, ey, fx, fy, cx, cy, 1)
+		tdx, tdy := t1x-fx, t1y-fy
+		if !intersects || tdx*tdx+tdy*tdy < 1e-5 { // use the last stop
+			return math.Inf(1)
+		}
+		dx, dy := ex-fx, ey-fy
+		return math.Sqrt(dx*dx+dy*dy) / math.Sqrt(tdx*tdx+tdy*tdy)
+	}
+}
+
+// stopColor returns the color at position `t` of a gradient.
+// If `repeating` is true, the range of `positions` is repeated,
+// otherwise the first and last colors are extended.
+func stopColor(positions []Fl, colors []parser.RGBA, t Fl, repeating bool) parser.RGBA {
+	L := len(positions)
+	if L == 0 || len(colors) < L {
+		return parser.RGBA{}
+	}
+	first, last := positions[0], positions[L-1]
+	if repeating && last > first {
+		t = first + Fl(math.Mod(float64(t-first), float64(last-first)))
+		if t < first {
+			t += last - first
+		}
+	}
+	if t <= first {
+		return colors[0]
+	}
+	for i := 1; i < L; i++ {
+		if t < positions[i] {
+			s := (t - positions[i-1]) / (positions[i] - positions[i-1])
+			return lerpRGBA(colors[i-1], colors[i], s)
+		}
+	}
+	return colors[L-1]
+}
+
+func lerpRGBA(c0, c1 parser.RGBA, t Fl) parser.RGBA {
+	return parser.RGBA{
+		R: c0.R + t*(c1.R-c0.R),
+		G: c0.G + t*(c1.G-c0.G),
+		B: c0.B + t*(c1.B-c0.B),
+		A: c0.A + t*(c1.A-c0.A),
+	}
+}
+
+func toNRGBA(c parser.RGBA) color.NRGBA {
+	clamp := func(v Fl) uint8 {
+		if v <= 0 {
+			return 0
+		} else if v >= 1 {
+			return 0xff
+		}
+		return uint8(v*0xff + 0.5)
+	}
+	return color.NRGBA{R: clamp(c.R), G: clamp(c.G), B: clamp(c.B), A: clamp(c.A)}
+}
+
+// maxPatchSamples bounds the number of samples along
+// each direction of a mesh patch
+const maxPatchSamples = 4096
+
+// rasterizeMesh paints the Coons patches of a mesh gradient on `img`,
+// which must be transparent, sampling each patch with a grid dense enough
+// to cover all its pixels. As required by the SVG specification,
+// the last patches are drawn over the first ones.
+func rasterizeMesh(img *image.RGBA, patches []backend.MeshPatch, dither Dithering) {
+	for i := range patches {
+		patch := coonsPatch{colors: patches[i].Colors}
+		for j, p := range patches[i].Points {
+			patch.points[j] = [2]float64{float64(p[0]), float64(p[1])}
+		}
+		patch.draw(img, dither)
+	}
+}
+
+// coonsPatch is the float64 version of backend.MeshPatch
+type coonsPatch struct {
+	points [12][2]float64
+	colors [4]parser.RGBA // at (0, 0), (1, 0), (1, 1), (0, 1)
+}
+
+// samples returns the number of samples required along each direction,
+// so that two successive samples are less than half a pixel apart
+func (patch *coonsPatch) samples() int {
+	var length float64 // of the longest control polygon, which bounds its curve
+	for c := 0; c < 4; c++ {
+		var l float64
+		for i := 3 * c; i < 3*c+3; i++ {
+			p, q := patch.points[i], patch.points[(i+1)%12]
+			l += math.Hypot(q[0]-p[0], q[1]-p[1])
+		}
+		length = math.Max(length, l)
+	}
+	n := int(math.Ceil(2*length)) + 2
+	if n > maxPatchSamples {
+		n = maxPatchSamples
+	}
+	return n
+}
+
+func (patch *coonsPatch) draw(img *image.RGBA, dither Dithering) {
+	n := patch.samples()
+	for j := 0; j < n; j++ {
+		v := float64(j) / float64(n-1)
+		for i := 0; i < n; i++ {
+			u := float64(i) / float64(n-1)
+			x, y := patch.at(u, v)
+			px, py := int(math.Floor(x)), int(math.Floor(y))
+			if !(image.Point{px, py}.In(img.Rect)) {
+				continue
+			}
+			c := lerpRGBA(
+				lerpRGBA(patch.colors[0], patch.colors[1], Fl(u)),
+				lerpRGBA(patch.colors[3], patch.colors[2], Fl(u)),
+				Fl(v),
+			)
+			img.Set(px, py, dither.quantize(c, px, py))
+		}
+	}
+}
+
+// at evaluates the patch at (u, v)
+func (patch *coonsPatch) at(u, v float64) (x, y float64) {
+	pts := &patch.points
+	top := cubicAt(pts[0], pts[1], pts[2], pts[3], u)
+	right := cubicAt(pts[3], pts[4], pts[5], pts[6], v)
+	bottom := cubicAt(pts[9], pts[8], pts[7], pts[6], u)
+	left := cubicAt(pts[0], pts[11], pts[10], pts[9], v)
+	p00, p10, p11, p01 := pts[0], pts[3], pts[6], pts[9]
+	coord := func(k int) float64 {
+		ruled := (1-v)*top[k] + v*bottom[k] + (1-u)*left[k] + u*right[k]
+		bilinear := (1-u)*(1-v)*p00[k] + u*(1-v)*p10[k] + u*v*p11[k] + (1-u)*v*p01[k]
+		return ruled - bilinear
+	}
+	return coord(0), coord(1)
+}
+
+func cubicAt(p0, p1, p2, p3 [2]float64, t float64) [2]float64 {
+	s := 1 - t
+	a, b, c, d := s*s*s, 3*s*s*t, 3*s*t*t, t*t*t
+	return [2]float64{
+		a*p0[0] + b*p1[0] + c*p2[0] + d*p3[0],
+		a*p0[1] + b*p1[1] + c*p2[1] + d*p3[1],
+	}
+}
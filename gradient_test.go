@@ -0,0 +1,161 @@
+package gosvg
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/benoitkugler/webrender/css/parser"
+)
+
+var (
+	red  = parser.RGBA{R: 1, A: 1}
+	blue = parser.RGBA{B: 1, A: 1}
+)
+
+func TestStopColor(t *testing.T) {
+	positions := []Fl{0.2, 0.6}
+	colors := []parser.RGBA{red, blue}
+	for _, tt := range []struct {
+		t         Fl
+		repeating bool
+		exp       color.NRGBA
+	}{
+		{0, false, color.NRGBA{R: 0xff, A: 0xff}},
+		{0.4, false, color.NRGBA{R: 0x80, B: 0x80, A: 0xff}},
+		{0.9, false, color.NRGBA{B: 0xff, A: 0xff}},
+		{0.8, true, color.NRGBA{R: 0x80, B: 0x80, A: 0xff}},
+		{0.1, true, color.NRGBA{R: 0x40, B: 0xbf, A: 0xff}},
+	} {
+		if got := toNRGBA(stopColor(positions, colors, tt.t, tt.repeating)); colorDistance(color.RGBA(got), color.RGBA(tt.exp)) > 1 {
+			t.Fatalf("at %g (%v): expected %v, got %v", tt.t, tt.repeating, tt.exp, got)
+		}
+	}
+}
+
+func TestConicGradient(t *testing.T) {
+	// the second square is painted with a repeating conic gradient,
+	// starting from the right, and centered at its top left corner
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="100">
+		<rect width="100" height="100" fill="conic-gradient(red, lime 25%, blue 50%, red)"/>
+		<rect x="100" width="100" height="100" style="fill: repeating-conic-gradient(from 90deg at 0 0, red, blue 45deg)"/>
+	</svg>`
+	img := renderWith(t, []byte(svg), nil)
+	for _, tt := range []struct {
+		x, y int
+		exp  color.RGBA
+	}{
+		{50, 5, color.RGBA{R: 0xff, A: 0xff}},          // top
+		{95, 50, color.RGBA{G: 0xff, A: 0xff}},         // right
+		{49, 95, color.RGBA{B: 0xff, A: 0xff}},         // bottom
+		{5, 50, color.RGBA{R: 0x80, B: 0x80, A: 0xff}}, // left
+		{195, 1, color.RGBA{R: 0xff, A: 0xff}},         // starting angle
+		{171, 70, color.RGBA{B: 0xff, A: 0xff}},        // end of the first repetition
+		{159, 60, color.RGBA{R: 0xff, A: 0xff}},        // start of the second repetition
+	} {
+		if got := img.RGBAAt(tt.x, tt.y); colorDistance(got, tt.exp) > 8 {
+			t.Fatalf("pixel (%d, %d): expected %v, got %v", tt.x, tt.y, tt.exp, got)
+		}
+	}
+}
+
+func TestMeshGradient(t *testing.T) {
+	// two patches, with straight edges, in bounding box units,
+	// and a third patch, with a curved top edge, in user space
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="200">
+		<defs>
+			<meshgradient id="bbox" x="0" y="0">
+				<meshrow>
+					<meshpatch>
+						<stop path="l 0.5,0" stop-color="red"/>
+						<stop path="l 0,1" stop-color="red"/>
+						<stop path="l -0.5,0" stop-color="blue"/>
+						<stop path="l 0,-1" stop-color="blue"/>
+					</meshpatch>
+					<meshpatch>
+						<stop path="l 0.5,0"/>
+						<stop path="l 0,1" stop-color="white"/>
+						<stop path="l -0.5,0" stop-color="white"/>
+					</meshpatch>
+				</meshrow>
+			</meshgradient>
+			<meshgradient id="user" x="20" y="140" gradientUnits="userSpaceOnUse">
+				<meshrow>
+					<meshpatch>
+						<stop path="c 10,-40 30,-40 40,0" stop-color="lime"/>
+						<stop path="l 0,40" stop-color="lime"/>
+						<stop path="l -40,0" stop-color="lime"/>
+						<stop path="l 0,-40" stop-color="lime"/>
+					</meshpatch>
+				</meshrow>
+			</meshgradient>
+		</defs>
+		<rect x="20" y="10" width="160" height="80" fill="url(#bbox)"/>
+		<rect x="10" y="100" width="80" height="90" fill="url(#user)"/>
+	</svg>`
+	img := renderWith(t, []byte(svg), nil)
+	for _, tt := range []struct {
+		x, y int
+		exp  color.RGBA
+	}{
+		{10, 50, color.RGBA{}},                          // outside of the shape
+		{60, 11, color.RGBA{R: 0xff, A: 0xff}},          // top of the first patch
+		{60, 88, color.RGBA{B: 0xff, A: 0xff}},          // bottom of the first patch
+		{60, 50, color.RGBA{R: 0x80, B: 0x80, A: 0xff}}, // center of the first patch
+		{178, 50, color.RGBA{0xff, 0xff, 0xff, 0xff}},   // right of the second patch
+		{40, 115, color.RGBA{G: 0xff, A: 0xff}},         // curved top edge
+		{40, 105, color.RGBA{}},                         // above the curved edge
+		{15, 150, color.RGBA{}},                         // outside of the patch
+	} {
+		if got := img.RGBAAt(tt.x, tt.y); colorDistance(got, tt.exp) > 8 {
+			t.Fatalf("pixel (%d, %d): expected %v, got %v", tt.x, tt.y, tt.exp, got)
+		}
+	}
+
+	// the patches cover all the pixels of the shape
+	for y := 10; y < 90; y++ {
+		for x := 20; x < 180; x++ {
+			if img.RGBAAt(x, y).A != 0xff {
+				t.Fatalf("pixel (%d, %d) is not covered", x, y)
+			}
+		}
+	}
+}
+
+func TestCurvedMeshPatch(t *testing.T) {
+	var patch coonsPatch
+	for i := range patch.points { // the square [0, 30] x [0, 30]
+		c, next := i/3, (i/3+1)%4
+		corners := [4][2]float64{{0, 0}, {30, 0}, {30, 30}, {0, 30}}
+		k := float64(i%3) / 3
+		patch.points[i] = [2]float64{
+			corners[c][0] + k*(corners[next][0]-corners[c][0]),
+			corners[c][1] + k*(corners[next][1]-corners[c][1]),
+		}
+	}
+	// bend the top edge upward
+	patch.points[1][1], patch.points[2][1] = -12, -12
+	if x, y := patch.at(0.5, 0); x != 15 || y != -9 {
+		t.Fatalf("unexpected top middle point (%g, %g)", x, y)
+	}
+	// the interior follows the boundary
+	if _, y := patch.at(0.5, 0.5); y != 10.5 {
+		t.Fatalf("unexpected center %g", y)
+	}
+}
+
+// returns the maximum difference between the channels
+func colorDistance(c1, c2 color.RGBA) int {
+	abs := func(a, b uint8) int {
+		if a > b {
+			return int(a - b)
+		}
+		return int(b - a)
+	}
+	out := abs(c1.R, c2.R)
+	for _, d := range [...]int{abs(c1.G, c2.G), abs(c1.B, c2.B), abs(c1.A, c2.A)} {
+		if d > out {
+			out = d
+		}
+	}
+	return out
+}
@@ -81,13 +81,28 @@ func (p path) rasterize(dst rasterx.Adder, mt matrix.Transform) {
 	}
 }
 
+// addTo adds the path to `dst`, ending each sub-path with
+// dst.Stop(closeSubpaths): fillers close the sub-paths,
+// strokers add caps to the open ones.
+func (p path) addTo(dst rasterx.Adder, mt matrix.Transform, closeSubpaths bool) {
+	for i, element := range p {
+		if element.op == moveTo && i != 0 {
+			dst.Stop(closeSubpaths)
+		}
+		element.rasterize(dst, mt)
+	}
+	if len(p) != 0 {
+		dst.Stop(closeSubpaths)
+	}
+}
+
 func newRectangle(x, y, width, height Fl) path {
 	return path{
 		newMoveTo(point{x, y}),
 		newLineTo(point{x + width, y}),
 		newLineTo(point{x + width, y + height}),
 		newLineTo(point{x, y + height}),
-		segment{op: close},
+		segment{op: closeOp},
 	}
 }
 
@@ -113,7 +128,7 @@ const (
 	lineTo
 	quadTo
 	cubeTo
-	close
+	closeOp
 )
 
 type segment struct {
@@ -131,7 +146,7 @@ func (s segment) rasterize(dst rasterx.Adder, mt matrix.Transform) {
 		dst.QuadBezier(s.args[0].toFixed(mt), s.args[1].toFixed(mt))
 	case cubeTo:
 		dst.CubeBezier(s.args[0].toFixed(mt), s.args[1].toFixed(mt), s.args[2].toFixed(mt))
-	case close:
+	case closeOp:
 		dst.Stop(true)
 	}
 }
@@ -174,7 +189,7 @@ func (s segment) String() string {
 		return fmt.Sprintf("<Q %s %s>", s.args[0], s.args[1])
 	case cubeTo:
 		return fmt.Sprintf("<C %s %s %s>", s.args[0], s.args[1], s.args[2])
-	case close:
+	case closeOp:
 		return "<close>"
 	}
 	return "<invalid>"
@@ -2,36 +2,120 @@ package gosvg
 
 import (
 	"image"
-	"image/draw"
+	"sync"
 
 	"github.com/benoitkugler/webrender/backend"
 )
 
+// applyOpacity multiplies the pixels of `img` by `opacity`.
+// Since img.Pix stores alpha-premultiplied values,
+// this amounts to multiply every component, which is done
+// with a lookup table.
 func applyOpacity(img *image.RGBA, opacity backend.Fl) {
-	// since img.Pix stores alpha-premultiplied values
-	// applying an opacity factor amounts to multiply
-	// every components
-	for i, p := range img.Pix {
-		img.Pix[i] = uint8(Fl(p) * opacity)
+	if opacity == 1 {
+		return
+	}
+	var table [256]uint8
+	for i := range table {
+		table[i] = uint8(Fl(i) * opacity)
+	}
+	b := img.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := img.PixOffset(b.Min.X, y)
+		row := img.Pix[i : i+4*b.Dx()]
+		for j, p := range row {
+			row[j] = table[p]
+		}
+	}
+}
+
+// layersPool stores the *image.RGBA used as intermediate layers,
+// which are recycled once merged into their parent
+var layersPool sync.Pool
+
+// getLayer returns a transparent image with bounds `r`,
+// reusing the memory of a released layer if possible
+func getLayer(r image.Rectangle) *image.RGBA {
+	n := 4 * r.Dx() * r.Dy()
+	if img, ok := layersPool.Get().(*image.RGBA); ok && cap(img.Pix) >= n {
+		pix := img.Pix[:n]
+		for i := range pix {
+			pix[i] = 0
+		}
+		return &image.RGBA{Pix: pix, Stride: 4 * r.Dx(), Rect: r}
+	} // else the image is too small and is dropped
+	return image.NewRGBA(r)
+}
+
+// putLayer releases `img`, which must not be used anymore
+func putLayer(img *image.RGBA) { layersPool.Put(img) }
+
+// overTable[sa][d] is the destination component `d`, with 16 bits
+// precision, attenuated by a source with alpha `sa`, as computed by
+// draw.Draw: d * (0xffff - sa) / 0xffff, with 16 bits components.
+var (
+	overTable     *[256][256]uint16
+	overTableOnce sync.Once
+)
+
+func initOverTable() {
+	overTable = new([256][256]uint16)
+	for sa := range overTable {
+		a := (0xffff - uint32(sa)*0x101) * 0x101
+		for d := range overTable[sa] {
+			overTable[sa][d] = uint16(uint32(d) * a / 0xffff)
+		}
 	}
 }
 
+// drawTo composes `src` over `dst`, where the pixels
+// of both images are in the same coordinates space.
+// The result is the same as draw.Draw with the Over operator.
 func drawTo(dst, src *image.RGBA) {
-	sr := src.Bounds()
-	dp := dst.Bounds().Min
-	r := image.Rectangle{dp, dp.Add(sr.Size())}
-	draw.Draw(dst, r, src, sr.Min, draw.Over)
+	overTableOnce.Do(initOverTable)
+	r := dst.Rect.Intersect(src.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i, j := dst.PixOffset(r.Min.X, y), src.PixOffset(r.Min.X, y)
+		drow, srow := dst.Pix[i:i+4*r.Dx()], src.Pix[j:j+4*r.Dx()]
+		for k := 0; k < len(srow); k += 4 {
+			s, d := srow[k:k+4:k+4], drow[k:k+4:k+4]
+			att := &overTable[s[3]]
+			d[0] = uint8((uint32(att[d[0]]) + uint32(s[0])*0x101) >> 8)
+			d[1] = uint8((uint32(att[d[1]]) + uint32(s[1])*0x101) >> 8)
+			d[2] = uint8((uint32(att[d[2]]) + uint32(s[2])*0x101) >> 8)
+			d[3] = uint8((uint32(att[d[3]]) + uint32(s[3])*0x101) >> 8)
+		}
+	}
 }
 
-// apply mask to `src`
+// applyOpacityMask multiplies the pixels of `src` by the values of `mask`.
+// As with draw.DrawMask, the pixels outside of the mask are unchanged.
 func applyOpacityMask(src *image.RGBA, mask *image.Alpha) {
-	dst := src // update src in place
-	sr := src.Bounds()
-	dp := dst.Bounds().Min
-	r := image.Rectangle{dp, dp.Add(sr.Size())}
-	draw.DrawMask(dst, r, src, sr.Min, mask, sr.Min, draw.Src)
+	r := src.Rect.Intersect(mask.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i, j := src.PixOffset(r.Min.X, y), mask.PixOffset(r.Min.X, y)
+		row, mrow := src.Pix[i:i+4*r.Dx()], mask.Pix[j:j+r.Dx()]
+		for k, m := range mrow {
+			p := row[4*k : 4*k+4 : 4*k+4]
+			switch m {
+			case 0xff:
+				continue
+			case 0:
+				p[0], p[1], p[2], p[3] = 0, 0, 0, 0
+				continue
+			}
+			// with 16 bits components, draw.DrawMask computes
+			// (s * m / 0xffff) >> 8, which simplifies to
+			ma := uint32(m) * 0x101
+			p[0] = uint8(uint32(p[0]) * ma / 0xff >> 8)
+			p[1] = uint8(uint32(p[1]) * ma / 0xff >> 8)
+			p[2] = uint8(uint32(p[2]) * ma / 0xff >> 8)
+			p[3] = uint8(uint32(p[3]) * ma / 0xff >> 8)
+		}
+	}
 }
 
+// rgbaToAlpha returns the luminance of the color
 func rgbaToAlpha(r, g, b uint8) uint8 {
 	const cR, cG, cB uint32 = 2989, 5870, 1141 // x 10_000
 
@@ -39,17 +123,22 @@ func rgbaToAlpha(r, g, b uint8) uint8 {
 	return uint8(v)
 }
 
-// interprets `img` as an alpha mask
-func rgbToAlpha(img *image.RGBA) *image.Alpha {
-	b := img.Bounds()
-	dst := image.NewAlpha(b)
-	for x := b.Min.X; x < b.Max.X; x++ {
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			i1 := img.PixOffset(x, y)
-			src := img.Pix[i1 : i1+3 : i1+3]
-
-			i2 := dst.PixOffset(x, y)
-			dst.Pix[i2] = rgbaToAlpha(src[0], src[1], src[2])
+// rgbToAlpha interprets `img`, which may be nil, as an alpha mask
+// with bounds `r`, using the luminance of its pixels.
+// The pixels of `r` outside of `img` are transparent.
+func rgbToAlpha(img *image.RGBA, r image.Rectangle) *image.Alpha {
+	dst := image.NewAlpha(r)
+	if img == nil {
+		return dst
+	}
+	b := img.Rect.Intersect(r)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := img.PixOffset(b.Min.X, y)
+		row := img.Pix[i : i+4*b.Dx()]
+		out := dst.Pix[dst.PixOffset(b.Min.X, y):]
+		for k := range out[:b.Dx()] {
+			p := row[4*k : 4*k+3 : 4*k+3]
+			out[k] = rgbaToAlpha(p[0], p[1], p[2])
 		}
 	}
 	return dst
@@ -3,11 +3,14 @@ package gosvg
 import (
 	"image"
 	"image/color"
+	"image/draw"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/benoitkugler/gosvg/compare"
 	"github.com/benoitkugler/webrender/backend"
 )
 
@@ -25,17 +28,15 @@ func sampleImage(L int) *image.RGBA {
 func assertEqual(t *testing.T, img1, img2 image.Image) {
 	t.Helper()
 
-	b1, b2 := img1.Bounds(), img2.Bounds()
-	if b1 != b2 {
-		t.Fatal()
+	if img1.Bounds() != img2.Bounds() {
+		t.Fatalf("different bounds %v and %v", img1.Bounds(), img2.Bounds())
 	}
-
-	for x := b1.Min.X; x < b1.Max.X; x++ {
-		for y := b1.Min.Y; y < b1.Max.Y; y++ {
-			if img1.At(x, y) != img2.At(x, y) {
-				t.Fatal()
-			}
-		}
+	res, err := compare.Compare(img1, img2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Equal() {
+		t.Fatalf("different images: %s", res)
 	}
 }
 
@@ -116,7 +117,7 @@ func TestAlphaMask(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	alpha := rgbToAlpha(s1)
+	alpha := rgbToAlpha(s1, s1.Rect)
 	asGray := (*image.Gray)(alpha)
 	if err := saveToPngFile(filepath.Join(tmp, "alpha_2.png"), asGray); err != nil {
 		t.Fatal(err)
@@ -132,7 +133,7 @@ func TestApplyOpacityMask(t *testing.T) {
 	}
 
 	s2 := sampleImage(50)
-	mask := rgbToAlpha(s2)
+	mask := rgbToAlpha(s2, s2.Rect)
 	asGray := (*image.Gray)(mask)
 	if err := saveToPngFile(filepath.Join(tmp, "alpha.png"), asGray); err != nil {
 		t.Fatal(err)
@@ -143,3 +144,153 @@ func TestApplyOpacityMask(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// randomImage returns an image with random (alpha-premultiplied) pixels,
+// some of them transparent or opaque
+func randomImage(rng *rand.Rand, r image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(r)
+	for i := 0; i < len(img.Pix); i += 4 {
+		var a uint8
+		switch rng.Intn(4) {
+		case 0:
+			a = 0
+		case 1:
+			a = 0xff
+		default:
+			a = uint8(rng.Intn(256))
+		}
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = uint8(rng.Intn(int(a) + 1))
+		}
+		img.Pix[i+3] = a
+	}
+	return img
+}
+
+func drawToSlow(dst, src *image.RGBA) {
+	sr := src.Bounds()
+	draw.Draw(dst, sr, src, sr.Min, draw.Over)
+}
+
+func applyOpacityMaskSlow(src *image.RGBA, mask *image.Alpha) {
+	sr := src.Bounds()
+	draw.DrawMask(src, sr, src, sr.Min, mask, sr.Min, draw.Src)
+}
+
+func rgbToAlphaSlow(img *image.RGBA) *image.Alpha {
+	b := img.Bounds()
+	dst := image.NewAlpha(b)
+	for x := b.Min.X; x < b.Max.X; x++ {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			c := img.RGBAAt(x, y)
+			dst.SetAlpha(x, y, color.Alpha{A: rgbaToAlpha(c.R, c.G, c.B)})
+		}
+	}
+	return dst
+}
+
+func TestCompositingEquivalence(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, rects := range [][2]image.Rectangle{
+		{image.Rect(0, 0, 50, 40), image.Rect(0, 0, 50, 40)},
+		{image.Rect(0, 0, 50, 40), image.Rect(10, 5, 70, 30)},
+		{image.Rect(-5, -5, 20, 20), image.Rect(3, 4, 15, 30)},
+	} {
+		dst1, src := randomImage(rng, rects[0]), randomImage(rng, rects[1])
+		dst2 := image.NewRGBA(dst1.Rect)
+		copy(dst2.Pix, dst1.Pix)
+		drawTo(dst1, src)
+		drawToSlow(dst2, src)
+		if !reflect.DeepEqual(dst1.Pix, dst2.Pix) {
+			t.Fatalf("drawTo %v over %v: different output", rects[1], rects[0])
+		}
+
+		mask := rgbToAlpha(randomImage(rng, rects[1]), rects[1])
+		src1 := randomImage(rng, rects[0])
+		src2 := image.NewRGBA(src1.Rect)
+		copy(src2.Pix, src1.Pix)
+		applyOpacityMask(src1, mask)
+		applyOpacityMaskSlow(src2, mask)
+		if !reflect.DeepEqual(src1.Pix, src2.Pix) {
+			t.Fatalf("applyOpacityMask %v on %v: different output", rects[1], rects[0])
+		}
+
+		if got, exp := rgbToAlpha(src, src.Rect), rgbToAlphaSlow(src); !reflect.DeepEqual(got, exp) {
+			t.Fatalf("rgbToAlpha %v: different output", rects[1])
+		}
+	}
+
+	for _, opacity := range []Fl{0, 0.2, 0.5, 0.77, 1} {
+		s1 := randomImage(rng, image.Rect(2, 3, 60, 40))
+		s2 := image.NewRGBA(s1.Rect)
+		copy(s2.Pix, s1.Pix)
+		applyOpacity(s1, opacity)
+		applyOpacitySlow(s2, opacity)
+		if !reflect.DeepEqual(s1.Pix, s2.Pix) {
+			t.Fatalf("applyOpacity %g: different output", opacity)
+		}
+	}
+}
+
+func benchmarkImages() (dst, src *image.RGBA) {
+	rng := rand.New(rand.NewSource(1))
+	r := image.Rect(0, 0, 512, 512)
+	return randomImage(rng, r), randomImage(rng, r)
+}
+
+func BenchmarkDrawTo(b *testing.B) {
+	dst, src := benchmarkImages()
+	for _, bench := range []struct {
+		name string
+		fn   func(dst, src *image.RGBA)
+	}{{"draw", drawToSlow}, {"kernel", drawTo}} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bench.fn(dst, src)
+			}
+		})
+	}
+}
+
+func BenchmarkApplyOpacity(b *testing.B) {
+	img, _ := benchmarkImages()
+	for _, bench := range []struct {
+		name string
+		fn   func(img *image.RGBA, opacity Fl)
+	}{{"float", applyOpacitySlow}, {"kernel", applyOpacity}} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bench.fn(img, 0.99)
+			}
+		})
+	}
+}
+
+func BenchmarkApplyOpacityMask(b *testing.B) {
+	img, src := benchmarkImages()
+	mask := rgbToAlpha(src, src.Rect)
+	for _, bench := range []struct {
+		name string
+		fn   func(img *image.RGBA, mask *image.Alpha)
+	}{{"draw", applyOpacityMaskSlow}, {"kernel", applyOpacityMask}} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bench.fn(img, mask)
+			}
+		})
+	}
+}
+
+func BenchmarkRgbToAlpha(b *testing.B) {
+	img, _ := benchmarkImages()
+	for _, bench := range []struct {
+		name string
+		fn   func(img *image.RGBA) *image.Alpha
+	}{{"column-major", rgbToAlphaSlow}, {"kernel", func(img *image.RGBA) *image.Alpha { return rgbToAlpha(img, img.Rect) }}} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bench.fn(img)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package gosvg
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Length is a dimension, as written in the document.
+type Length struct {
+	Value float64
+	// Unit is empty for user units, or one of
+	// "px", "pt", "pc", "mm", "cm", "in", "q", "em", "ex", "%"
+	Unit string
+}
+
+func (l Length) String() string { return strconv.FormatFloat(l.Value, 'g', -1, 64) + l.Unit }
+
+var lengthUnits = [...]string{"px", "pt", "pc", "mm", "cm", "in", "q", "em", "ex", "%"}
+
+// parseLength parses a length attribute, returning false
+// for invalid or negative values
+func parseLength(s string) (Length, bool) {
+	s = strings.TrimSpace(s)
+	var out Length
+	lower := strings.ToLower(s)
+	for _, unit := range lengthUnits {
+		if strings.HasSuffix(lower, unit) {
+			out.Unit = unit
+			s = s[:len(s)-len(unit)]
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(v >= 0) || math.IsInf(v, 1) {
+		return Length{}, false
+	}
+	out.Value = v
+	return out, true
+}
+
+// ViewBox is the value of the viewBox attribute.
+type ViewBox struct {
+	MinX, MinY, Width, Height float64
+}
+
+// parseViewBox returns nil for invalid values
+func parseViewBox(s string) *ViewBox {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r' })
+	if len(fields) != 4 {
+		return nil
+	}
+	var values [4]float64
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil
+		}
+		values[i] = v
+	}
+	if values[2] < 0 || values[3] < 0 {
+		return nil
+	}
+	return &ViewBox{values[0], values[1], values[2], values[3]}
+}
+
+// PreserveAspectRatio is the value of the preserveAspectRatio attribute.
+type PreserveAspectRatio struct {
+	// Align is "none", or one of "xMinYMin", "xMidYMin", ..., "xMaxYMax"
+	Align string
+	// Slice is true for "slice", false for "meet"
+	Slice bool
+}
+
+// parsePreserveAspectRatio returns the default value "xMidYMid meet"
+// for empty or invalid values
+func parsePreserveAspectRatio(s string) PreserveAspectRatio {
+	out := PreserveAspectRatio{Align: "xMidYMid"}
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return out
+	}
+	align := fields[0]
+	if align != "none" {
+		if len(align) != 8 || align[0] != 'x' || align[4] != 'Y' ||
+			!isAlignKeyword(align[1:4]) || !isAlignKeyword(align[5:8]) {
+			return out
+		}
+	}
+	if len(fields) == 2 {
+		switch fields[1] {
+		case "meet":
+		case "slice":
+			out.Slice = true
+		default:
+			return PreserveAspectRatio{Align: "xMidYMid"}
+		}
+	}
+	out.Align = align
+	return out
+}
+
+func isAlignKeyword(s string) bool { return s == "Min" || s == "Mid" || s == "Max" }
+
+// Metadata describes an SVG image, as returned by Inspect.
+type Metadata struct {
+	// Width and Height are the intrinsic size of the image,
+	// nil if the attributes are missing or invalid.
+	Width, Height *Length
+	// ViewBox is nil if the attribute is missing or invalid.
+	ViewBox             *ViewBox
+	PreserveAspectRatio PreserveAspectRatio
+
+	// Title and Desc are the text of the <title> and <desc>
+	// children of the root element, with the white spaces collapsed.
+	Title, Desc string
+
+	// IDs are the identifiers of all the elements, in document order.
+	IDs []string
+	// Symbols are the identifiers of the <symbol> elements.
+	Symbols []string
+}
+
+// Inspect returns the metadata of the SVG image read from `src`,
+// without rendering it.
+func Inspect(src io.Reader) (Metadata, error) {
+	doc, err := parseDocument(src)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return doc.metadata(), nil
+}
+
+// metadata implements Inspect
+func (doc *document) metadata() Metadata {
+	var out Metadata
+	out.readRoot(doc.root)
+	if id := attribute(doc.root, "id"); id != "" {
+		out.IDs = append(out.IDs, strings.TrimSpace(id))
+	}
+	walk(doc.root, func(elem *html.Node, depth int) bool {
+		if id := attribute(elem, "id"); id != "" {
+			id = strings.TrimSpace(id)
+			out.IDs = append(out.IDs, id)
+			if elem.Data == "symbol" {
+				out.Symbols = append(out.Symbols, id)
+			}
+		}
+		if depth == 1 {
+			collapsed := strings.Join(strings.Fields(childrenText(elem)), " ")
+			if elem.Data == "title" && out.Title == "" {
+				out.Title = collapsed
+			} else if elem.Data == "desc" && out.Desc == "" {
+				out.Desc = collapsed
+			}
+		}
+		return true
+	})
+	return out
+}
+
+// readRoot stores the attributes of the <svg> element
+func (md *Metadata) readRoot(root *html.Node) {
+	md.PreserveAspectRatio = parsePreserveAspectRatio("")
+	for _, attr := range root.Attr {
+		if attr.Namespace != "" {
+			continue
+		}
+		switch attr.Key {
+		case "width":
+			if l, ok := parseLength(attr.Val); ok {
+				md.Width = &l
+			}
+		case "height":
+			if l, ok := parseLength(attr.Val); ok {
+				md.Height = &l
+			}
+		case "viewBox":
+			md.ViewBox = parseViewBox(attr.Val)
+		case "preserveAspectRatio":
+			md.PreserveAspectRatio = parsePreserveAspectRatio(attr.Val)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package gosvg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	md, err := Inspect(strings.NewReader(`<?xml version="1.0"?>
+	<svg xmlns="http://www.w3.org/2000/svg" id="root" width="10.5mm" height="20" viewBox="0, 0 100 200" preserveAspectRatio="xMinYMax slice">
+		<title>  An
+			icon &amp; more </title>
+		<desc>Description</desc>
+		<defs>
+			<symbol id="s1"><title>Not the title</title></symbol>
+			<symbol id="s2"/>
+		</defs>
+		<rect id="r" width="10" height="10"/>
+	</svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := Metadata{
+		Width:               &Length{10.5, "mm"},
+		Height:              &Length{20, ""},
+		ViewBox:             &ViewBox{0, 0, 100, 200},
+		PreserveAspectRatio: PreserveAspectRatio{Align: "xMinYMax", Slice: true},
+		Title:               "An icon & more",
+		Desc:                "Description",
+		IDs:                 []string{"root", "s1", "s2", "r"},
+		Symbols:             []string{"s1", "s2"},
+	}
+	if !reflect.DeepEqual(md, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, md)
+	}
+
+	md, err = Inspect(strings.NewReader(`<svg width="auto" height="-2" viewBox="0 0 10"/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Width != nil || md.Height != nil || md.ViewBox != nil || md.PreserveAspectRatio.Align != "xMidYMid" {
+		t.Fatalf("unexpected metadata %+v", md)
+	}
+
+	for _, src := range []string{"", "not an svg", "<html></html>"} {
+		if _, err := Inspect(strings.NewReader(src)); err == nil {
+			t.Fatalf("expected error for %q", src)
+		}
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	for s, exp := range map[string]Length{
+		"12":     {12, ""},
+		" 1.5in": {1.5, "in"},
+		"3PT":    {3, "pt"},
+		"50%":    {50, "%"},
+		"2e1px":  {20, "px"},
+		"4Q":     {4, "q"},
+	} {
+		if got, ok := parseLength(s); !ok || got != exp {
+			t.Fatalf("%q: expected %v, got %v (%v)", s, exp, got, ok)
+		}
+	}
+	for _, s := range []string{"", "px", "-1", "NaN", "Inf", "12 apples", "auto"} {
+		if _, ok := parseLength(s); ok {
+			t.Fatalf("%q: expected invalid length", s)
+		}
+	}
+}
+
+func TestParsePreserveAspectRatio(t *testing.T) {
+	for s, exp := range map[string]PreserveAspectRatio{
+		"":                {"xMidYMid", false},
+		"none":            {"none", false},
+		"xMaxYMin meet":   {"xMaxYMin", false},
+		"xMidYMax slice":  {"xMidYMax", true},
+		"xMidYMax cut":    {"xMidYMid", false},
+		"xmidymid":        {"xMidYMid", false},
+		"none slice more": {"xMidYMid", false},
+	} {
+		if got := parsePreserveAspectRatio(s); got != exp {
+			t.Fatalf("%q: expected %v, got %v", s, exp, got)
+		}
+	}
+}
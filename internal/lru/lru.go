@@ -0,0 +1,78 @@
+// Package lru implements a cache bounded by the total size of its values,
+// evicting the least recently used ones first.
+// It is shared by the glyph cache and the cache of the server.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	entries map[interface{}]*list.Element // of *entry
+	order   list.List                     // most recently used first
+}
+
+type entry struct {
+	key, value interface{}
+	size       int64
+}
+
+// New returns a cache storing values up to a total of `maxSize`,
+// in the unit chosen by the caller.
+func New(maxSize int64) *Cache {
+	return &Cache{maxSize: maxSize, entries: make(map[interface{}]*list.Element)}
+}
+
+// Get returns the value stored for `key`, which is then
+// the most recently used.
+func (c *Cache) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*entry).value, true
+}
+
+// Add stores `value`, evicting the least recently used entries
+// if needed, unless it is bigger than the whole cache.
+// If `key` is already present (added concurrently), its value is kept.
+func (c *Cache) Add(key, value interface{}, size int64) {
+	if size > c.maxSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, size: size})
+	c.size += size
+	for c.size > c.maxSize {
+		last := c.order.Back()
+		e := c.order.Remove(last).(*entry)
+		delete(c.entries, e.key)
+		c.size -= e.size
+	}
+}
+
+// Len returns the number of values stored.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Size returns the total size of the values stored.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
@@ -0,0 +1,27 @@
+package lru
+
+import "testing"
+
+func TestCache(t *testing.T) {
+	c := New(10)
+	c.Add("a", 1, 4)
+	c.Add("b", 2, 4)
+	if _, ok := c.Get("a"); !ok { // "a" is now the most recently used
+		t.Fatal("missing a")
+	}
+	c.Add("c", 3, 4) // evicts "b"
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("unexpected a: %v", v)
+	}
+	c.Add("a", 4, 4) // already present
+	if v, _ := c.Get("a"); v != 1 {
+		t.Fatalf("unexpected a: %v", v)
+	}
+	c.Add("d", 5, 11) // too big
+	if c.Len() != 2 || c.Size() != 8 {
+		t.Fatalf("unexpected cache %d %d", c.Len(), c.Size())
+	}
+}
@@ -0,0 +1,136 @@
+package gosvg
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Limits bounds the resources used when rendering an image,
+// which is useful when the input is not trusted.
+// A zero value means no limit.
+type Limits struct {
+	// MaxPixels is the maximum number of pixels of the output image.
+	MaxPixels int64
+	// MaxLayerBytes is the maximum memory, in bytes, used at the same time
+	// by the intermediate layers (groups, masks, patterns) and by
+	// the coverage buffers of RasterizerCell (8 bytes per pixel).
+	MaxLayerBytes int64
+	// MaxDepth is the maximum nesting of graphic states.
+	MaxDepth int
+	// MaxPathSegments is the maximum number of path segments
+	// (move, line or curve) drawn for the whole image.
+	MaxPathSegments int
+	// Timeout is the wall-clock budget of one rendering.
+	Timeout time.Duration
+}
+
+// LimitError is returned when rendering an image would
+// exceed one of the values of Limits.
+type LimitError struct {
+	Limit string // name of the exceeded limit
+	Value int64  // value required by the image
+	Max   int64  // maximum allowed value
+}
+
+func (err LimitError) Error() string {
+	return fmt.Sprintf("gosvg: %s limit exceeded (%d > %d)", err.Limit, err.Value, err.Max)
+}
+
+// checking the context on every segment is a bit costly,
+// so we only do it periodically
+const segmentsPerContextCheck = 1024
+
+// addSegment returns false if the path segment should not be drawn.
+// `drawn` counts the segments of one drawing (see Canvas.segments).
+// Since the tiles of an image all draw the same segments, the limit
+// applies to the largest count, which is the one of the whole image.
+func (s *session) addSegment(drawn *int64) bool {
+	if s == nil {
+		return true
+	}
+	*drawn++
+	segments := *drawn
+	for {
+		largest := atomic.LoadInt64(&s.segments)
+		if segments <= largest || atomic.CompareAndSwapInt64(&s.segments, largest, segments) {
+			break
+		}
+	}
+	if max := int64(s.limits.MaxPathSegments); max > 0 && segments > max {
+		s.fail(LimitError{Limit: "path segments", Value: segments, Max: max})
+		return false
+	}
+	if segments%segmentsPerContextCheck == 0 {
+		return s.checkContext()
+	}
+	return true
+}
+
+func layerSize(r image.Rectangle) int64 { return 4 * int64(r.Dx()) * int64(r.Dy()) }
+
+// allocLayer returns false if a layer with bounds `r`
+// may not be allocated
+func (s *session) allocLayer(r image.Rectangle) bool { return s.allocBytes(layerSize(r)) }
+
+// releaseLayer must be called when a layer allocated
+// with `allocLayer` is not used anymore
+func (s *session) releaseLayer(r image.Rectangle) { s.releaseBytes(layerSize(r)) }
+
+// allocBytes returns false if an intermediate buffer of
+// `size` bytes (see Limits.MaxLayerBytes) may not be allocated
+func (s *session) allocBytes(size int64) bool {
+	if s == nil {
+		return true
+	}
+	if !s.checkContext() {
+		return false
+	}
+	total := atomic.AddInt64(&s.layerBytes, size)
+	if max := s.limits.MaxLayerBytes; max > 0 && total > max {
+		atomic.AddInt64(&s.layerBytes, -size)
+		s.fail(LimitError{Limit: "layer memory", Value: total, Max: max})
+		return false
+	}
+	s.budget.add(size)
+	return true
+}
+
+// releaseBytes must be called when a buffer allocated
+// with `allocBytes` is not used anymore
+func (s *session) releaseBytes(size int64) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.layerBytes, -size)
+	s.budget.release(size)
+}
+
+// pushState returns false if a new graphic state,
+// at nesting level `depth`, may not be created
+func (s *session) pushState(depth int) bool {
+	if s == nil {
+		return true
+	}
+	if max := s.limits.MaxDepth; max > 0 && depth > max {
+		s.fail(LimitError{Limit: "nesting depth", Value: int64(depth), Max: int64(max)})
+		return false
+	}
+	return s.checkContext()
+}
+
+// checkOutputSize returns an error if an image of size `width` x `height`
+// is not allowed
+func (limits Limits) checkOutputSize(width, height Fl) error {
+	if !(width >= 0 && height >= 0 && width <= math.MaxInt32 && height <= math.MaxInt32) {
+		return fmt.Errorf("gosvg: invalid image size %gx%g", width, height)
+	}
+	if max := limits.MaxPixels; max > 0 {
+		if pixels := float64(width) * float64(height); !(pixels <= float64(max)) {
+			return LimitError{Limit: "output pixels", Value: int64(math.Min(pixels, math.MaxInt64)), Max: max}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package gosvg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func nestedGroups(depth int, attrs string) string {
+	return fmt.Sprintf(template, strings.Repeat("<g "+attrs+">", depth)+
+		`<rect x="10" y="10" width="50" height="50" fill="red" />`+
+		strings.Repeat("</g>", depth))
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits Limits
+		limit  string // expected limit, empty for success
+	}{
+		{`<svg viewBox="0 0 100000 100000"></svg>`, Limits{MaxPixels: 1e6}, "output pixels"},
+		{`<svg viewBox="0 0 1000 1000"></svg>`, Limits{MaxPixels: 1e6}, ""},
+		{nestedGroups(20, ""), Limits{MaxDepth: 10}, "nesting depth"},
+		{nestedGroups(5, ""), Limits{MaxDepth: 10}, ""},
+		// the layers of the groups are sized to the 50x50 rectangle,
+		// and two of them are needed at the same time to merge them
+		{nestedGroups(5, `opacity="0.5"`), Limits{MaxLayerBytes: 50 * 50 * 4 * 3 / 2}, "layer memory"},
+		{nestedGroups(5, `opacity="0.5"`), Limits{MaxLayerBytes: 50 * 50 * 4 * 2}, ""},
+		// the groups without opacity nor mask draw into their parent
+		{nestedGroups(100, ""), Limits{MaxLayerBytes: 1}, ""},
+		{fmt.Sprintf(template, `<polygon points="0,0 10,0 10,10 0,10 5,5" />`), Limits{MaxPathSegments: 3}, "path segments"},
+		{fmt.Sprintf(template, `<polygon points="0,0 10,0 10,10 0,10 5,5" />`), Limits{MaxPathSegments: 10}, ""},
+	}
+	for _, tt := range tests {
+		_, err := RenderWithOptions(context.Background(), strings.NewReader(tt.input), &Options{Limits: tt.limits})
+		if tt.limit == "" {
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var limitErr LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("expected LimitError, got %v", err)
+		}
+		if limitErr.Limit != tt.limit {
+			t.Fatalf("expected %s limit, got %s", tt.limit, limitErr.Limit)
+		}
+	}
+}
+
+func TestCellsLimits(t *testing.T) {
+	input := fmt.Sprintf(template, `<rect width="600" height="600" />`)
+	const cells = 600 * 600 * 8 // the cells of the whole 600x600 image
+	for _, tt := range []struct {
+		opts Options
+		ok   bool
+	}{
+		{Options{Rasterizer: RasterizerCell, Limits: Limits{MaxLayerBytes: cells - 1}}, false},
+		{Options{Rasterizer: RasterizerCell, Limits: Limits{MaxLayerBytes: cells}}, true},
+		{Options{Antialiasing: AntialiasSupersample, Limits: Limits{MaxLayerBytes: 1}}, true}, // the edges are stored instead
+		// the cells of each tile are sized to the tile
+		{Options{TileSize: 300, TileWorkers: 1, Rasterizer: RasterizerCell, Limits: Limits{MaxLayerBytes: cells/4 - 1}}, false},
+		{Options{TileSize: 300, TileWorkers: 1, Rasterizer: RasterizerCell, Limits: Limits{MaxLayerBytes: cells / 4}}, true},
+	} {
+		_, err := RenderWithOptions(context.Background(), strings.NewReader(input), &tt.opts)
+		var limitErr LimitError
+		if tt.ok && err != nil {
+			t.Fatalf("%+v: %s", tt.opts, err)
+		} else if !tt.ok && !(errors.As(err, &limitErr) && limitErr.Limit == "layer memory") {
+			t.Fatalf("%+v: expected layer memory limit, got %v", tt.opts, err)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := RenderWithOptions(ctx, strings.NewReader(nestedGroups(5, "")), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package gosvg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// EncodePNG writes `img`, whose pixels are in the color space `cs`
+// (see Options.ColorSpace), as a PNG image.
+// The color space is described by the ancillary chunks of the image:
+// sRGB for ColorSpaceSRGB, and an ICC profile (iCCP) for the other spaces.
+// The cHRM and gAMA chunks are also written, for the decoders
+// which do not support the former.
+func EncodePNG(w io.Writer, img image.Image, cs ColorSpace) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	// the signature and the IHDR chunk come first
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	content := buf.Bytes()
+
+	var chunks bytes.Buffer
+	if cs == ColorSpaceSRGB {
+		writeChunk(&chunks, "sRGB", []byte{0}) // perceptual intent
+	} else {
+		profile, err := iccpChunk(cs)
+		if err != nil {
+			return err
+		}
+		writeChunk(&chunks, "iCCP", profile)
+	}
+	writeChunk(&chunks, "gAMA", uint32Bytes(cs.pngGamma()))
+	writeChunk(&chunks, "cHRM", chrmChunk(cs.chromaticities()))
+
+	for _, part := range [][]byte{content[:ihdrEnd], chunks.Bytes(), content[ihdrEnd:]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pngGamma returns the value of the gAMA chunk, which is the
+// exponent of the encoding (approximating the sRGB curve)
+func (cs ColorSpace) pngGamma() uint32 {
+	if cs.isLinear() {
+		return 100000
+	}
+	return 45455
+}
+
+func uint32Bytes(v uint32) []byte {
+	var out [4]byte
+	binary.BigEndian.PutUint32(out[:], v)
+	return out[:]
+}
+
+func writeChunk(w *bytes.Buffer, kind string, data []byte) {
+	w.Write(uint32Bytes(uint32(len(data))))
+	start := w.Len()
+	w.WriteString(kind)
+	w.Write(data)
+	w.Write(uint32Bytes(crc32.ChecksumIEEE(w.Bytes()[start:])))
+}
+
+func chrmChunk(ch chromaticities) []byte {
+	var out []byte
+	for _, xy := range [...][2]float64{ch.white, ch.red, ch.green, ch.blue} {
+		out = append(out, uint32Bytes(uint32(math.Round(xy[0]*100000)))...)
+		out = append(out, uint32Bytes(uint32(math.Round(xy[1]*100000)))...)
+	}
+	return out
+}
+
+// iccpChunk returns the content of the iCCP chunk:
+// the profile name and its compressed data
+func iccpChunk(cs ColorSpace) ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString(cs.profileName())
+	out.Write([]byte{0, 0}) // null separator, zlib compression
+	zw := zlib.NewWriter(&out)
+	if _, err := zw.Write(iccProfile(cs)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (cs ColorSpace) profileName() string {
+	switch cs {
+	case ColorSpaceDisplayP3:
+		return "Display P3"
+	case ColorSpaceLinearSRGB:
+		return "Linear sRGB"
+	default:
+		return "sRGB"
+	}
+}
+
+// d50 is the white point of the profile connection space
+var d50 = [3]float64{0.9642, 1, 0.8249}
+
+// bradford returns the chromatic adaptation matrix from
+// the white point `white` to D50
+func bradford(white [3]float64) matrix3 {
+	cone := matrix3{
+		{0.8951, 0.2664, -0.1614},
+		{-0.7502, 1.7135, 0.0367},
+		{0.0389, -0.0685, 1.0296},
+	}
+	src, dst := cone.apply(white), cone.apply(d50)
+	scale := matrix3{{dst[0] / src[0], 0, 0}, {0, dst[1] / src[1], 0}, {0, 0, dst[2] / src[2]}}
+	return cone.invert().mul(scale).mul(cone)
+}
+
+// s15Fixed16 encodes `v` as a ICC fixed point number
+func s15Fixed16(v float64) []byte {
+	return uint32Bytes(uint32(int32(math.Round(v * 65536))))
+}
+
+// iccProfile returns a version 4 matrix/TRC display profile for the color space
+func iccProfile(cs ColorSpace) []byte {
+	ch := cs.chromaticities()
+	chad := bradford(xyToXYZ(ch.white))
+	toPCS := chad.mul(ch.toXYZ())
+
+	xyzTag := func(v [3]float64) []byte {
+		out := append([]byte("XYZ "), 0, 0, 0, 0)
+		for _, c := range v {
+			out = append(out, s15Fixed16(c)...)
+		}
+		return out
+	}
+	column := func(j int) [3]float64 { return [3]float64{toPCS[0][j], toPCS[1][j], toPCS[2][j]} }
+
+	var trc []byte
+	if cs.isLinear() {
+		trc = append([]byte("para"), 0, 0, 0, 0, 0, 0, 0, 0)
+		trc = append(trc, s15Fixed16(1)...)
+	} else { // function type 3: the sRGB curve
+		trc = append([]byte("para"), 0, 0, 0, 0, 0, 3, 0, 0)
+		for _, p := range [...]float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+			trc = append(trc, s15Fixed16(p)...)
+		}
+	}
+
+	chadTag := append([]byte("sf32"), 0, 0, 0, 0)
+	for _, row := range chad {
+		for _, c := range row {
+			chadTag = append(chadTag, s15Fixed16(c)...)
+		}
+	}
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", mlucTag(cs.profileName())},
+		{"cprt", mlucTag("No copyright, use freely")},
+		{"wtpt", xyzTag(d50)},
+		{"chad", chadTag},
+		{"rXYZ", xyzTag(column(0))},
+		{"gXYZ", xyzTag(column(1))},
+		{"bXYZ", xyzTag(column(2))},
+		{"rTRC", trc},
+		{"gTRC", trc}, // the data of the curves is shared
+		{"bTRC", trc},
+	}
+
+	const headerSize = 128
+	var (
+		table = uint32Bytes(uint32(len(tags)))
+		data  []byte
+	)
+	dataStart := headerSize + 4 + 12*len(tags)
+	offsets := map[string]int{} // shared data
+	for _, tag := range tags {
+		offset, ok := offsets[string(tag.data)]
+		if !ok {
+			offset = dataStart + len(data)
+			offsets[string(tag.data)] = offset
+			data = append(data, tag.data...)
+			for len(data)%4 != 0 { // tags are 4 bytes aligned
+				data = append(data, 0)
+			}
+		}
+		table = append(table, tag.signature...)
+		table = append(table, uint32Bytes(uint32(offset))...)
+		table = append(table, uint32Bytes(uint32(len(tag.data)))...)
+	}
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header[0:], uint32(headerSize+len(table)+len(data)))
+	binary.BigEndian.PutUint32(header[8:], 0x04300000) // version 4.3
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	// a fixed creation date, so that the output is deterministic
+	for i, v := range [...]uint16{2022, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	for i, c := range d50 {
+		copy(header[68+4*i:], s15Fixed16(c))
+	}
+
+	return append(append(header, table...), data...)
+}
+
+// mlucTag returns a multiLocalizedUnicodeType tag with an english text
+func mlucTag(text string) []byte {
+	out := append([]byte("mluc"), 0, 0, 0, 0)
+	out = append(out, uint32Bytes(1)...)  // number of records
+	out = append(out, uint32Bytes(12)...) // record size
+	out = append(out, "enUS"...)
+	units := utf16.Encode([]rune(text))
+	out = append(out, uint32Bytes(uint32(2*len(units)))...)
+	out = append(out, uint32Bytes(28)...) // offset of the string
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
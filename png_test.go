@@ -0,0 +1,101 @@
+package gosvg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// pngChunks returns the kind and content of the chunks of a PNG file
+func pngChunks(content []byte) (kinds []string, data map[string][]byte) {
+	data = make(map[string][]byte)
+	content = content[8:]
+	for len(content) != 0 {
+		size := binary.BigEndian.Uint32(content)
+		kind := string(content[4:8])
+		kinds = append(kinds, kind)
+		data[kind] = content[8 : 8+size]
+		content = content[12+size:]
+	}
+	return kinds, data
+}
+
+// iccTag returns the data of the tag `signature`
+func iccTag(profile []byte, signature string) []byte {
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count; i++ {
+		entry := profile[132+12*i:]
+		if string(entry[:4]) == signature {
+			offset, size := binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:])
+			return profile[offset : offset+size]
+		}
+	}
+	return nil
+}
+
+func TestEncodePNG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Pix[0] = 0xff
+	for _, tt := range []struct {
+		cs    ColorSpace
+		kinds []string
+		red   [3]float64 // rXYZ of the profile
+	}{
+		{ColorSpaceSRGB, []string{"IHDR", "sRGB", "gAMA", "cHRM", "IDAT", "IEND"}, [3]float64{}},
+		{ColorSpaceDisplayP3, []string{"IHDR", "iCCP", "gAMA", "cHRM", "IDAT", "IEND"}, [3]float64{0.5151, 0.2412, -0.0011}},
+		{ColorSpaceLinearSRGB, []string{"IHDR", "iCCP", "gAMA", "cHRM", "IDAT", "IEND"}, [3]float64{0.4361, 0.2225, 0.0139}},
+	} {
+		var buf bytes.Buffer
+		if err := EncodePNG(&buf, img, tt.cs); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := png.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Bounds() != img.Bounds() {
+			t.Fatalf("unexpected bounds %v", decoded.Bounds())
+		}
+
+		kinds, data := pngChunks(buf.Bytes())
+		if !reflect.DeepEqual(kinds, tt.kinds) {
+			t.Fatalf("space %d: unexpected chunks %v", tt.cs, kinds)
+		}
+		if tt.cs == ColorSpaceSRGB {
+			continue
+		}
+
+		iccp := data["iCCP"]
+		name := iccp[:bytes.IndexByte(iccp, 0)]
+		if string(name) != tt.cs.profileName() {
+			t.Fatalf("unexpected profile name %q", name)
+		}
+		r, err := zlib.NewReader(bytes.NewReader(iccp[len(name)+2:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := binary.BigEndian.Uint32(profile); int(size) != len(profile) || string(profile[36:40]) != "acsp" {
+			t.Fatalf("invalid profile header")
+		}
+		red := iccTag(profile, "rXYZ")
+		for i, exp := range tt.red {
+			got := float64(int32(binary.BigEndian.Uint32(red[8+4*i:]))) / 65536
+			if math.Abs(got-exp) > 1e-3 {
+				t.Fatalf("space %d: rXYZ[%d]: expected %g, got %g", tt.cs, i, exp, got)
+			}
+		}
+		if len(iccTag(profile, "rTRC")) == 0 || len(iccTag(profile, "desc")) == 0 {
+			t.Fatal("missing tags")
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package gosvg
+
+import (
+	"strings"
+
+	"github.com/benoitkugler/webrender/backend"
+)
+
+// cutDeclaration splits a CSS declaration `name: value`
+func cutDeclaration(decl string) (name, value string, ok bool) {
+	i := strings.IndexByte(decl, ':')
+	if i == -1 {
+		return "", "", false
+	}
+	return strings.TrimSpace(decl[:i]), strings.TrimSpace(decl[i+1:]), true
+}
+
+// paintOrder is a parsed value of the paint-order property
+type paintOrder struct {
+	strokeFirst bool // the stroke is painted before the fill
+	// the operations painted after the markers,
+	// among backend.Stroke and the fill rules
+	afterMarkers backend.PaintOp
+}
+
+// parsePaintOrder parses a value of the paint-order property.
+// Invalid values are interpreted as "normal".
+func parsePaintOrder(value string) paintOrder {
+	const (
+		fill = iota
+		stroke
+		markers
+	)
+	var (
+		order []int
+		seen  [3]bool
+	)
+	for _, keyword := range strings.Fields(value) {
+		var part int
+		switch keyword {
+		case "fill":
+			part = fill
+		case "stroke":
+			part = stroke
+		case "markers":
+			part = markers
+		default: // "normal" may not be combined with the other keywords
+			return paintOrder{}
+		}
+		if seen[part] {
+			return paintOrder{}
+		}
+		seen[part] = true
+		order = append(order, part)
+	}
+	// the missing keywords are painted in the default order
+	for part, ok := range seen {
+		if !ok {
+			order = append(order, part)
+		}
+	}
+
+	var (
+		out        paintOrder
+		filled     bool
+		afterMarks bool
+	)
+	for _, part := range order {
+		switch part {
+		case fill:
+			filled = true
+			if afterMarks {
+				out.afterMarkers |= backend.FillEvenOdd | backend.FillNonZero
+			}
+		case stroke:
+			out.strokeFirst = !filled
+			if afterMarks {
+				out.afterMarkers |= backend.Stroke
+			}
+		case markers:
+			afterMarks = true
+		}
+	}
+	return out
+}
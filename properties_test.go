@@ -0,0 +1,31 @@
+package gosvg
+
+import (
+	"testing"
+
+	"github.com/benoitkugler/webrender/backend"
+)
+
+func TestParsePaintOrder(t *testing.T) {
+	const fill = backend.FillEvenOdd | backend.FillNonZero
+	for order, exp := range map[string]paintOrder{
+		"":                      {},
+		"normal":                {},
+		"fill":                  {},
+		"markers":               {afterMarkers: fill | backend.Stroke},
+		"stroke":                {strokeFirst: true},
+		"markers stroke":        {strokeFirst: true, afterMarkers: fill | backend.Stroke},
+		"stroke fill markers":   {strokeFirst: true},
+		"stroke markers":        {strokeFirst: true, afterMarkers: fill},
+		"fill markers":          {afterMarkers: backend.Stroke},
+		"fill stroke":           {},
+		"normal stroke":         {},
+		"stroke stroke":         {},
+		"stroke invalid":        {},
+		" markers  fill stroke": {afterMarkers: fill | backend.Stroke},
+	} {
+		if got := parsePaintOrder(order); got != exp {
+			t.Fatalf("%q: expected %v, got %v", order, exp, got)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package gosvg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Quantization converts the output to an image with few colors,
+// like the grayscale images of e-ink displays, or the PNG8 images
+// (see Options.Quantize).
+type Quantization struct {
+	// Gray, if true, makes the output an *image.Gray, with
+	// GrayLevels levels equally spaced between black and white.
+	// Otherwise, the output is an *image.Paletted.
+	Gray bool
+	// GrayLevels is the number of gray levels, between 2 (black and white)
+	// and 256, which is the default.
+	GrayLevels int
+	// Background is the color the image is composed over for the
+	// gray output, which has no alpha channel. It defaults to white.
+	Background color.Color
+
+	// Palette is the palette of the *image.Paletted output,
+	// with at most 256 colors.
+	// If it is empty, a palette of at most Colors colors is computed from
+	// the image, with the median cut algorithm (the colors are used
+	// as they are if there are not more of them).
+	Palette color.Palette
+	// Colors is the size of the computed palette, between 2 and 256,
+	// which is the default.
+	Colors int
+
+	// Dither selects how the quantization error is spread.
+	Dither QuantizeDither
+}
+
+// QuantizeDither selects how the colors of the output are
+// mapped to the quantized colors.
+type QuantizeDither uint8
+
+const (
+	// QuantizeNearest uses the nearest color.
+	QuantizeNearest QuantizeDither = iota
+	// QuantizeOrdered adds the noise of the thresholds of DitherOrdered.
+	QuantizeOrdered
+	// QuantizeBlueNoise adds the noise of the thresholds of DitherBlueNoise.
+	QuantizeBlueNoise
+	// QuantizeFloydSteinberg diffuses the quantization error
+	// to the neighbour pixels.
+	QuantizeFloydSteinberg
+)
+
+// threshold returns the offset in [0, 1) added to the
+// pixel (x, y) by the ordered ditherings
+func (d QuantizeDither) threshold(x, y int) Fl {
+	switch d {
+	case QuantizeOrdered:
+		return DitherOrdered.threshold(x, y)
+	case QuantizeBlueNoise:
+		return DitherBlueNoise.threshold(x, y)
+	default:
+		return 0.5
+	}
+}
+
+// apply returns the quantized version of `img`
+func (q *Quantization) apply(img *image.RGBA) image.Image {
+	if q.Gray {
+		return q.toGray(img)
+	}
+	return q.toPaletted(img)
+}
+
+// clampCount returns `n` in [2, 256], defaulting to 256
+func clampCount(n int) int {
+	if n <= 0 || n > 256 {
+		return 256
+	}
+	if n < 2 {
+		return 2
+	}
+	return n
+}
+
+// toGray composes `img` over the background, and quantizes its luma.
+func (q *Quantization) toGray(img *image.RGBA) *image.Gray {
+	levels := clampCount(q.GrayLevels)
+	step := 255 / float32(levels-1)
+	var background float32 = 255
+	if q.Background != nil {
+		background = float32(color.GrayModel.Convert(q.Background).(color.Gray).Y)
+	}
+
+	out := image.NewGray(img.Rect)
+	qz := quantizer{
+		channels: 1,
+		spread:   step,
+		dither:   q.Dither,
+		pixel: func(x, y int, c []float32) {
+			p := img.Pix[img.PixOffset(x, y):]
+			// same weights as color.GrayModel, on premultiplied components
+			luma := (19595*float32(p[0]) + 38470*float32(p[1]) + 7471*float32(p[2])) / 65536
+			c[0] = luma + background*(255-float32(p[3]))/255
+		},
+		nearest: func(c, quantized []float32) int {
+			level := int(clamp255(c[0])/step + 0.5)
+			quantized[0] = float32(level) * step
+			return int(quantized[0] + 0.5)
+		},
+		set: func(x, y, v int) { out.Pix[out.PixOffset(x, y)] = uint8(v) },
+	}
+	qz.run(img.Rect)
+	return out
+}
+
+// toPaletted maps the pixels of `img` to the palette, computing it if needed.
+func (q *Quantization) toPaletted(img *image.RGBA) *image.Paletted {
+	palette := q.Palette
+	if len(palette) > 256 {
+		palette = palette[:256]
+	}
+	if len(palette) == 0 {
+		palette = medianCut(img, clampCount(q.Colors))
+	}
+	// premultiplied components, in [0, 255]
+	colors := make([][4]float32, len(palette))
+	for i, c := range palette {
+		r, g, b, a := c.RGBA()
+		colors[i] = [4]float32{float32(r) / 0x101, float32(g) / 0x101, float32(b) / 0x101, float32(a) / 0x101}
+	}
+
+	out := image.NewPaletted(img.Rect, palette)
+	// the images usually have few distinct colors
+	cache := make(map[[4]uint8]int)
+	qz := quantizer{
+		channels: 4,
+		spread:   paletteSpread(len(palette)),
+		dither:   q.Dither,
+		pixel: func(x, y int, c []float32) {
+			p := img.Pix[img.PixOffset(x, y):]
+			c[0], c[1], c[2], c[3] = float32(p[0]), float32(p[1]), float32(p[2]), float32(p[3])
+		},
+		nearest: func(c, quantized []float32) int {
+			var key [4]uint8
+			for i := range key {
+				key[i] = uint8(clamp255(c[i]) + 0.5)
+			}
+			index, ok := cache[key]
+			if !ok {
+				index = nearestColor(colors, key)
+				cache[key] = index
+			}
+			copy(quantized, colors[index][:])
+			return index
+		},
+		set: func(x, y, index int) { out.Pix[out.PixOffset(x, y)] = uint8(index) },
+	}
+	qz.run(img.Rect)
+	return out
+}
+
+// nearestColor returns the index of the color closest to `c`,
+// the first one for ties
+func nearestColor(colors [][4]float32, c [4]uint8) int {
+	best, bestDist := 0, float32(math.Inf(1))
+	for i, p := range colors {
+		var dist float32
+		for j, v := range p {
+			d := v - float32(c[j])
+			dist += d * d
+		}
+		if dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// paletteSpread approximates the distance between the colors of a
+// palette of `n` colors, as if they were regularly spaced in the RGB cube
+func paletteSpread(n int) float32 {
+	perAxis := math.Max(2, math.Round(math.Cbrt(float64(n))))
+	return float32(255 / (perAxis - 1))
+}
+
+func clamp255(v float32) float32 {
+	if v < 0 {
+		return 0
+	} else if v > 255 {
+		return 255
+	}
+	return v
+}
+
+// quantizer maps the pixels of an image to a set of colors
+// with `channels` components, in [0, 255].
+type quantizer struct {
+	channels int
+	// amplitude of the noise added by the ordered dithering,
+	// which is the distance between two colors
+	spread float32
+	dither QuantizeDither
+
+	// pixel stores the components of the pixel (x, y) in `c`
+	pixel func(x, y int, c []float32)
+	// nearest returns the closest color of `c`, storing its
+	// components in `quantized`
+	nearest func(c, quantized []float32) int
+	// set stores the color of the pixel (x, y)
+	set func(x, y, color int)
+}
+
+// run quantizes the pixels of `bounds`, from top to bottom,
+// and from left to right
+func (qz quantizer) run(bounds image.Rectangle) {
+	n, width := qz.channels, bounds.Dx()
+	c, quantized := make([]float32, n), make([]float32, n)
+	var errs, nextErrs []float32 // for Floyd-Steinberg, with one pixel of margin
+	if qz.dither == QuantizeFloydSteinberg {
+		errs, nextErrs = make([]float32, (width+2)*n), make([]float32, (width+2)*n)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			qz.pixel(x, y, c)
+			switch qz.dither {
+			case QuantizeNearest:
+			case QuantizeFloydSteinberg:
+				e := errs[(x-bounds.Min.X+1)*n:]
+				for i := range c {
+					c[i] += e[i]
+				}
+			default:
+				offset := qz.spread * (qz.dither.threshold(x, y) - 0.5)
+				for i := range c {
+					c[i] += offset
+				}
+			}
+			qz.set(x, y, qz.nearest(c, quantized))
+
+			if qz.dither == QuantizeFloydSteinberg {
+				i := (x - bounds.Min.X + 1) * n
+				for k := range c {
+					d := clamp255(c[k]) - quantized[k]
+					errs[i+n+k] += d * 7 / 16
+					nextErrs[i-n+k] += d * 3 / 16
+					nextErrs[i+k] += d * 5 / 16
+					nextErrs[i+n+k] += d * 1 / 16
+				}
+			}
+		}
+		if qz.dither == QuantizeFloydSteinberg {
+			errs, nextErrs = nextErrs, errs
+			for i := range nextErrs {
+				nextErrs[i] = 0
+			}
+		}
+	}
+}
+
+// medianCut returns a palette of at most `n` colors, representing the
+// (premultiplied) colors of `img`.
+func medianCut(img *image.RGBA, n int) color.Palette {
+	counts := make(map[[4]uint8]int)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			var c [4]uint8
+			copy(c[:], row[4*x:4*x+4])
+			counts[c]++
+		}
+	}
+	entries := make([]colorCount, 0, len(counts))
+	for c, count := range counts {
+		entries = append(entries, colorCount{c, count})
+	}
+	// the map order is random
+	sort.Slice(entries, func(i, j int) bool { return entries[i].less(entries[j]) })
+
+	if len(entries) <= n {
+		out := make(color.Palette, len(entries))
+		for i, e := range entries {
+			out[i] = color.RGBA{R: e.c[0], G: e.c[1], B: e.c[2], A: e.c[3]}
+		}
+		return out
+	}
+
+	boxes := []colorBox{newColorBox(entries)}
+	for len(boxes) < n {
+		// split the box with the widest range
+		best := -1
+		for i, box := range boxes {
+			if len(box.entries) > 1 && (best == -1 || box.width() > boxes[best].width()) {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		lower, upper := boxes[best].split()
+		boxes[best] = lower
+		boxes = append(boxes, upper)
+	}
+
+	out := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		out[i] = box.average()
+	}
+	return out
+}
+
+type colorCount struct {
+	c     [4]uint8 // premultiplied RGBA
+	count int
+}
+
+func (cc colorCount) less(other colorCount) bool {
+	for i := range cc.c {
+		if cc.c[i] != other.c[i] {
+			return cc.c[i] < other.c[i]
+		}
+	}
+	return false
+}
+
+// colorBox is a set of colors, whose widest component
+// ranges from min to max
+type colorBox struct {
+	entries  []colorCount
+	channel  int
+	min, max uint8
+}
+
+func newColorBox(entries []colorCount) colorBox {
+	out := colorBox{entries: entries}
+	var low, high [4]uint8
+	for i := range low {
+		low[i] = 0xff
+	}
+	for _, e := range entries {
+		for i, v := range e.c {
+			if v < low[i] {
+				low[i] = v
+			}
+			if v > high[i] {
+				high[i] = v
+			}
+		}
+	}
+	for i := range low {
+		if high[i]-low[i] > out.max-out.min || i == 0 {
+			out.channel, out.min, out.max = i, low[i], high[i]
+		}
+	}
+	return out
+}
+
+func (box colorBox) width() int { return int(box.max) - int(box.min) }
+
+// split divides the box at the weighted median of its widest component
+func (box colorBox) split() (lower, upper colorBox) {
+	entries, channel := box.entries, box.channel
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].c[channel] < entries[j].c[channel] })
+	var total int
+	for _, e := range entries {
+		total += e.count
+	}
+	// both halves are non empty
+	cut, acc := 1, entries[0].count
+	for ; cut < len(entries)-1 && 2*acc < total; cut++ {
+		acc += entries[cut].count
+	}
+	return newColorBox(entries[:cut:cut]), newColorBox(entries[cut:])
+}
+
+// average returns the mean color of the box, weighted by the pixel counts
+func (box colorBox) average() color.RGBA {
+	var sums [4]int
+	var total int
+	for _, e := range box.entries {
+		for i, v := range e.c {
+			sums[i] += int(v) * e.count
+		}
+		total += e.count
+	}
+	var out [4]uint8
+	for i, sum := range sums {
+		out[i] = uint8((sum + total/2) / total)
+	}
+	return color.RGBA{R: out[0], G: out[1], B: out[2], A: out[3]}
+}
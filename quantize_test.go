@@ -0,0 +1,153 @@
+package gosvg
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// uniformImage returns an image filled with `c`
+func uniformImage(c color.RGBA, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func meanGray(img *image.Gray) float64 {
+	var sum float64
+	for _, v := range img.Pix {
+		sum += float64(v)
+	}
+	return sum / float64(len(img.Pix))
+}
+
+func TestQuantizeGray(t *testing.T) {
+	gray := uniformImage(color.RGBA{0x80, 0x80, 0x80, 0xff}, 64, 64)
+	for _, dither := range []QuantizeDither{QuantizeNearest, QuantizeOrdered, QuantizeBlueNoise, QuantizeFloydSteinberg} {
+		for _, levels := range []int{2, 4} {
+			q := Quantization{Gray: true, GrayLevels: levels, Dither: dither}
+			out := q.toGray(gray)
+			allowed := map[uint8]bool{0: true, 0xff: true}
+			if levels == 4 {
+				allowed = map[uint8]bool{0: true, 85: true, 170: true, 0xff: true}
+			}
+			for _, v := range out.Pix {
+				if !allowed[v] {
+					t.Fatalf("dithering %d, %d levels: unexpected value %d", dither, levels, v)
+				}
+			}
+			mean := meanGray(out)
+			switch {
+			case dither == QuantizeNearest && levels == 2:
+				if mean != 0xff {
+					t.Fatalf("expected white, got %g", mean)
+				}
+			case dither != QuantizeNearest:
+				// the dithering preserves the average intensity
+				if mean < 0x80-4 || mean > 0x80+4 {
+					t.Fatalf("dithering %d, %d levels: unexpected mean %g", dither, levels, mean)
+				}
+			}
+		}
+	}
+
+	// the transparent pixels are composed over the background
+	transparent := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	if out := (&Quantization{Gray: true}).toGray(transparent); out.GrayAt(1, 1).Y != 0xff {
+		t.Fatalf("expected a white background, got %v", out.GrayAt(1, 1))
+	}
+	q := Quantization{Gray: true, Background: color.Black}
+	if out := q.toGray(transparent); out.GrayAt(1, 1).Y != 0 {
+		t.Fatalf("expected a black background, got %v", out.GrayAt(1, 1))
+	}
+}
+
+func TestQuantizeFixedPalette(t *testing.T) {
+	palette := color.Palette{color.RGBA{A: 0xff}, color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}}
+	img := uniformImage(color.RGBA{0xe0, 0x10, 0x10, 0xff}, 8, 8)
+	out := (&Quantization{Palette: palette}).toPaletted(img)
+	for _, index := range out.Pix {
+		if index != 1 {
+			t.Fatalf("expected red, got %d", index)
+		}
+	}
+
+	// a pink surface is dithered with red and white
+	img = uniformImage(color.RGBA{0xff, 0x80, 0x80, 0xff}, 32, 32)
+	out = (&Quantization{Palette: palette, Dither: QuantizeFloydSteinberg}).toPaletted(img)
+	var counts [3]int
+	for _, index := range out.Pix {
+		counts[index]++
+	}
+	if counts[0] != 0 || counts[1] < 400 || counts[2] < 400 {
+		t.Fatalf("unexpected distribution %v", counts)
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+	// few colors are kept as they are
+	img := uniformImage(color.RGBA{0xff, 0, 0, 0xff}, 10, 10)
+	img.SetRGBA(1, 1, color.RGBA{0, 0, 0xff, 0xff})
+	img.SetRGBA(2, 2, color.RGBA{})
+	palette := medianCut(img, 256)
+	if len(palette) != 3 {
+		t.Fatalf("unexpected palette %v", palette)
+	}
+	out := (&Quantization{}).toPaletted(img)
+	for _, p := range []image.Point{{0, 0}, {1, 1}, {2, 2}} {
+		if got, exp := out.At(p.X, p.Y), img.At(p.X, p.Y); got != exp {
+			t.Fatalf("at %v: expected %v, got %v", p, exp, got)
+		}
+	}
+
+	// a gradient is approximated
+	img = image.NewRGBA(image.Rect(0, 0, 256, 4))
+	for x := 0; x < 256; x++ {
+		for y := 0; y < 4; y++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(255 - x), 0x40, 0xff})
+		}
+	}
+	out = (&Quantization{Colors: 16}).toPaletted(img)
+	if len(out.Palette) != 16 {
+		t.Fatalf("unexpected palette size %d", len(out.Palette))
+	}
+	for x := 0; x < 256; x++ {
+		got := out.At(x, 0).(color.RGBA)
+		if d := int(got.R) - x; d > 16 || d < -16 {
+			t.Fatalf("at %d: unexpected color %v", x, got)
+		}
+	}
+}
+
+func TestRenderQuantized(t *testing.T) {
+	src := `<svg xmlns="http://www.w3.org/2000/svg" width="40" height="20">
+		<rect width="20" height="20" fill="black"/>
+	</svg>`
+	img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &Options{
+		Quantize: &Quantization{Gray: true, GrayLevels: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("unexpected image type %T", img)
+	}
+	if gray.GrayAt(5, 5).Y != 0 || gray.GrayAt(30, 5).Y != 0xff {
+		t.Fatal("unexpected pixels")
+	}
+
+	img, err = RenderWithOptions(context.Background(), strings.NewReader(src), &Options{
+		Quantize: &Quantization{Dither: QuantizeOrdered},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paletted, ok := img.(*image.Paletted); !ok || len(paletted.Palette) != 2 {
+		t.Fatalf("unexpected image %T", img)
+	}
+}
@@ -0,0 +1,190 @@
+package gosvg
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/srwiley/rasterx"
+	"golang.org/x/image/math/fixed"
+)
+
+// Rasterizer selects the algorithm computing the area
+// of each pixel covered by the shapes.
+type Rasterizer uint8
+
+const (
+	// RasterizerGV uses rasterx.ScannerGV, built on the rasterizer of the
+	// golang.org/x/image/vector package. Since it only supports the nonzero
+	// fill rule, the evenodd fills and the shapes using another anti-aliasing
+	// than AntialiasStandard (see Options.Antialiasing) are rasterized
+	// with RasterizerCell. It does not support Options.TileSize.
+	RasterizerGV Rasterizer = iota
+	// RasterizerCell is an exact signed area rasterizer, using integer
+	// arithmetic, in the spirit of the FreeType one.
+	// It supports all the Antialiasing modes and both fill rules,
+	// and renders tiles without seams.
+	RasterizerCell
+	// RasterizerFT uses the FreeType port of the github.com/srwiley/scanFT
+	// module (ScannerFT). Since this module is GPL licensed, it is only
+	// available when building with the gosvg_ft tag, the main module
+	// requiring github.com/srwiley/scanFT: otherwise, rendering with
+	// RasterizerFT returns an error.
+	// As with RasterizerGV, the shapes using another anti-aliasing than
+	// AntialiasStandard are rasterized with RasterizerCell, and
+	// Options.TileSize is not supported.
+	RasterizerFT
+)
+
+func (r Rasterizer) String() string {
+	switch r {
+	case RasterizerGV:
+		return "RasterizerGV"
+	case RasterizerCell:
+		return "RasterizerCell"
+	case RasterizerFT:
+		return "RasterizerFT"
+	default:
+		return "<invalid Rasterizer>"
+	}
+}
+
+// scanner is a rasterx.Scanner whose output may be changed
+// between two paths
+type scanner interface {
+	rasterx.Scanner
+	setTarget(dst *image.RGBA)
+}
+
+// newScanner returns a scanner accumulating edges in `bounds`, which
+// may not start at (0, 0) (see `renderTiles`), using the
+// rasterizer of `sess` and the given anti-aliasing (see `cellScanner.samples`).
+func newScanner(bounds image.Rectangle, sess *session, samples int) scanner {
+	switch kind := sess.rasterizerKind(); {
+	case kind == RasterizerGV && samples == 0:
+		return newGVScanner(bounds)
+	case kind == RasterizerFT && samples == 0 && newFTScanner != nil:
+		return newFTScanner(bounds)
+	default:
+		return newCellScanner(bounds, sess, samples)
+	}
+}
+
+// newFTScanner returns a scanner using RasterizerFT,
+// and is nil unless building with the gosvg_ft tag.
+var newFTScanner func(bounds image.Rectangle) scanner
+
+// blendPixel composes the color (sr, sg, sb, sa), with coverage `ma`,
+// over the pixel `pix`. All the values are in [0, 0xffff].
+func blendPixel(pix []uint8, sr, sg, sb, sa, ma uint32) {
+	// same formula as x/image/vector
+	a := 0xffff - (sa * ma / 0xffff)
+	pix[0] = uint8(((uint32(pix[0])*0x101*a + sr*ma) / 0xffff) >> 8)
+	pix[1] = uint8(((uint32(pix[1])*0x101*a + sg*ma) / 0xffff) >> 8)
+	pix[2] = uint8(((uint32(pix[2])*0x101*a + sb*ma) / 0xffff) >> 8)
+	pix[3] = uint8(((uint32(pix[3])*0x101*a + sa*ma) / 0xffff) >> 8)
+}
+
+var _ scanner = (*gvScanner)(nil)
+
+// gvScanner adapts a rasterx.ScannerGV to the `scanner` interface.
+//
+// A ScannerGV draws its whole area at the top left corner of its destination,
+// and calls the color functions in this space. So that the points
+// and the colors are given in the absolute pixel space, as for `cellScanner`,
+// and only the pixels of the target are drawn, the points are recorded
+// and handed to the ScannerGV when drawing, relatively to the
+// part of the target covered by the path.
+type gvScanner struct {
+	sc *rasterx.ScannerGV
+
+	dst    *image.RGBA     // may be nil
+	clip   image.Rectangle // optional, in absolute pixel space
+	origin image.Point
+	size   image.Point
+
+	points []gvPoint
+	extent fixed.Rectangle26_6
+
+	color interface{} // color.Color or rasterx.ColorFunc, in absolute pixel space
+}
+
+// gvPoint is a recorded call to Start or Line
+type gvPoint struct {
+	p     fixed.Point26_6
+	start bool
+}
+
+func newGVScanner(bounds image.Rectangle) *gvScanner {
+	sc := &gvScanner{sc: rasterx.NewScannerGV(0, 0, nil, image.Rectangle{}), origin: bounds.Min, color: color.Black}
+	sc.SetBounds(bounds.Dx(), bounds.Dy())
+	return sc
+}
+
+func (sc *gvScanner) setTarget(dst *image.RGBA) { sc.dst = dst }
+
+// SetBounds sets the size of the area, and calls Clear.
+func (sc *gvScanner) SetBounds(width, height int) {
+	sc.size = image.Pt(width, height)
+	sc.Clear()
+}
+
+// Clear cancels any previous accumulated path.
+func (sc *gvScanner) Clear() {
+	sc.points = sc.points[:0]
+	sc.extent = emptyExtent()
+}
+
+// SetColor accepts a color.Color or a rasterx.ColorFunc
+func (sc *gvScanner) SetColor(c interface{}) { sc.color = c }
+
+// SetWinding is a no-op, since ScannerGV only
+// supports the nonzero winding rule.
+func (sc *gvScanner) SetWinding(useNonZeroWinding bool) {}
+
+func (sc *gvScanner) SetClip(rect image.Rectangle) { sc.clip = rect }
+
+func (sc *gvScanner) GetPathExtent() fixed.Rectangle26_6 { return sc.extent }
+
+func (sc *gvScanner) add(p fixed.Point26_6, start bool) {
+	growExtent(&sc.extent, p)
+	sc.points = append(sc.points, gvPoint{p: p, start: start})
+}
+
+// Start starts a new sub-path at `a`, closing the previous one.
+func (sc *gvScanner) Start(a fixed.Point26_6) { sc.add(a, true) }
+
+func (sc *gvScanner) Line(b fixed.Point26_6) { sc.add(b, false) }
+
+// Draw renders the accumulated path onto the target.
+func (sc *gvScanner) Draw() {
+	if len(sc.points) == 0 || sc.dst == nil {
+		return
+	}
+	area := image.Rectangle{Min: sc.origin, Max: sc.origin.Add(sc.size)}
+	r := sc.dst.Rect.Intersect(pixelBounds(sc.extent)).Intersect(area)
+	if sc.clip != (image.Rectangle{}) {
+		r = r.Intersect(sc.clip)
+	}
+	if r.Empty() {
+		return
+	}
+
+	sc.sc.SetBounds(r.Dx(), r.Dy())
+	sc.sc.Clear()
+	sc.sc.Dest = sc.dst.SubImage(r).(*image.RGBA)
+	switch c := sc.color.(type) {
+	case color.Color:
+		sc.sc.SetColor(c)
+	case rasterx.ColorFunc:
+		sc.sc.SetColor(rasterx.ColorFunc(func(x, y int) color.Color { return c(x+r.Min.X, y+r.Min.Y) }))
+	}
+	offset := fixed.Point26_6{X: fixed.I(r.Min.X), Y: fixed.I(r.Min.Y)}
+	for _, p := range sc.points {
+		if p.start {
+			sc.sc.Start(p.p.Sub(offset))
+		} else {
+			sc.sc.Line(p.p.Sub(offset))
+		}
+	}
+	sc.sc.Draw()
+}
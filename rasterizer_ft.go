@@ -0,0 +1,138 @@
+//go:build gosvg_ft
+// +build gosvg_ft
+
+package gosvg
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/srwiley/rasterx"
+	"github.com/srwiley/scanFT"
+	"golang.org/x/image/math/fixed"
+)
+
+func init() {
+	newFTScanner = func(bounds image.Rectangle) scanner { return newFTScannerIn(bounds) }
+}
+
+var _ scanner = (*ftScanner)(nil)
+
+// ftScanner adapts a scanFT.ScannerFT to the `scanner` interface.
+//
+// A ScannerFT covers an area starting at (0, 0). So that the points
+// and the colors are given in the absolute pixel space, as for `cellScanner`,
+// the points are translated by the origin of the area, and the spans are
+// translated back by `ftPainter`, which only draws the pixels of the target.
+type ftScanner struct {
+	sc      *scanFT.ScannerFT
+	painter *ftPainter
+	origin  fixed.Point26_6
+	extent  fixed.Rectangle26_6 // in absolute pixel space
+}
+
+func newFTScannerIn(bounds image.Rectangle) *ftScanner {
+	painter := &ftPainter{origin: bounds.Min, color: color.Black}
+	sc := &ftScanner{
+		sc:      scanFT.NewScannerFT(bounds.Dx(), bounds.Dy(), painter),
+		painter: painter,
+		origin:  fixed.Point26_6{X: fixed.I(bounds.Min.X), Y: fixed.I(bounds.Min.Y)},
+	}
+	sc.Clear()
+	return sc
+}
+
+func (sc *ftScanner) setTarget(dst *image.RGBA) { sc.painter.dst = dst }
+
+// SetBounds sets the size of the area, and calls Clear.
+func (sc *ftScanner) SetBounds(width, height int) {
+	sc.sc.SetBounds(width, height)
+	sc.Clear()
+}
+
+// Clear cancels any previous accumulated path.
+func (sc *ftScanner) Clear() {
+	sc.sc.Clear()
+	sc.extent = emptyExtent()
+}
+
+// SetColor accepts a color.Color or a rasterx.ColorFunc
+func (sc *ftScanner) SetColor(c interface{}) { sc.painter.color = c }
+
+func (sc *ftScanner) SetWinding(useNonZeroWinding bool) { sc.sc.SetWinding(useNonZeroWinding) }
+
+func (sc *ftScanner) SetClip(rect image.Rectangle) { sc.painter.clip = rect }
+
+func (sc *ftScanner) GetPathExtent() fixed.Rectangle26_6 { return sc.extent }
+
+// Start starts a new sub-path at `a`, closing the previous one.
+func (sc *ftScanner) Start(a fixed.Point26_6) {
+	growExtent(&sc.extent, a)
+	sc.sc.Start(a.Sub(sc.origin))
+}
+
+func (sc *ftScanner) Line(b fixed.Point26_6) {
+	growExtent(&sc.extent, b)
+	sc.sc.Line(b.Sub(sc.origin))
+}
+
+// Draw renders the accumulated path onto the target.
+func (sc *ftScanner) Draw() {
+	if sc.painter.dst == nil {
+		return
+	}
+	sc.sc.Draw()
+}
+
+// ftPainter blends the spans of a ScannerFT, translated by `origin`,
+// into `dst`, with a color.Color or a rasterx.ColorFunc given in
+// the absolute pixel space.
+type ftPainter struct {
+	dst    *image.RGBA     // may be nil
+	clip   image.Rectangle // optional, in absolute pixel space
+	origin image.Point
+	color  interface{}
+}
+
+// SetColor is a no-op: the color is set by ftScanner.SetColor,
+// and not handed to the ScannerFT.
+func (p *ftPainter) SetColor(interface{}) {}
+
+// Paint ignores the clip of the ScannerFT, since the one of
+// the painter is given in the absolute pixel space.
+func (p *ftPainter) Paint(spans []scanFT.Span, done bool, _ image.Rectangle) {
+	r := p.dst.Rect
+	if p.clip != (image.Rectangle{}) {
+		r = r.Intersect(p.clip)
+	}
+	var (
+		sr, sg, sb, sa uint32
+		colorFunc      rasterx.ColorFunc
+	)
+	switch c := p.color.(type) {
+	case color.Color:
+		sr, sg, sb, sa = c.RGBA()
+	case rasterx.ColorFunc:
+		colorFunc = c
+	}
+	for _, span := range spans {
+		y := span.Y + p.origin.Y
+		if y < r.Min.Y || y >= r.Max.Y {
+			continue
+		}
+		x0, x1 := span.X0+p.origin.X, span.X1+p.origin.X
+		if x0 < r.Min.X {
+			x0 = r.Min.X
+		}
+		if x1 > r.Max.X {
+			x1 = r.Max.X
+		}
+		for x := x0; x < x1; x++ {
+			if colorFunc != nil {
+				sr, sg, sb, sa = colorFunc(x, y).RGBA()
+			}
+			i := p.dst.PixOffset(x, y)
+			blendPixel(p.dst.Pix[i:i+4:i+4], sr, sg, sb, sa, span.Alpha)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build gosvg_ft
+// +build gosvg_ft
+
+package gosvg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFTScannerTarget(t *testing.T) {
+	full := image.NewRGBA(image.Rect(10, 10, 100, 100))
+	part := image.NewRGBA(image.Rect(20, 30, 70, 60))
+	for _, dst := range [...]*image.RGBA{full, part} {
+		// the path is always accumulated in the whole area,
+		// which does not start at (0, 0)
+		sc := newFTScannerIn(full.Rect)
+		sc.setTarget(dst)
+		sc.SetColor(color.RGBA{B: 0xff, A: 0xff})
+		sc.Start(flToFixed(-5.5, 10.2))
+		sc.Line(flToFixed(80.3, 40.7))
+		sc.Line(flToFixed(40.1, 90.9))
+		sc.Line(flToFixed(-5.5, 10.2))
+		sc.Draw()
+	}
+	assertEqual(t, full.SubImage(part.Rect), part)
+	if got := full.RGBAAt(40, 40).A; got != 0xff {
+		t.Fatalf("expected opaque pixel, got %d", got)
+	}
+}
@@ -0,0 +1,150 @@
+package gosvg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/benoitkugler/gosvg/compare"
+	"github.com/benoitkugler/webrender/backend"
+)
+
+func renderWith(t *testing.T, content []byte, opts *Options) *image.RGBA {
+	t.Helper()
+	img, err := RenderWithOptions(context.Background(), bytes.NewReader(content), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img.(*image.RGBA)
+}
+
+// rasterizerTolerance bounds the differences between the golden icons
+// rendered with a rasterizer and with RasterizerCell, the reference,
+// for outputs 400 pixels wide (small outputs would magnify them)
+type rasterizerTolerance struct {
+	small float64 // the fraction of pixels differing by more than 2
+	large float64 // the fraction of pixels differing by more than 32
+	ssim  float64 // the minimum SSIM
+}
+
+var rasterizerTolerances = map[Rasterizer]rasterizerTolerance{
+	// The anti-aliasing of x/image/vector is not exactly the same (it
+	// accumulates the coverage in floating point above 512 pixels), and
+	// the overlapping sub-paths are not handled the same way: most icons
+	// differ on less than 0.6% of the pixels, up to 1.25% for trees.svg,
+	// with less than 0.1% of large differences, on thin overlapping parts.
+	RasterizerGV: {small: 0.015, large: 0.001, ssim: 0.999},
+	// ScannerFT computes the exact covered areas with the same algorithm
+	// as RasterizerCell, so that only the rounding of the coverage of
+	// the edges differs.
+	RasterizerFT: {small: 0.01, large: 0.001, ssim: 0.999},
+}
+
+func TestRasterizers(t *testing.T) {
+	for kind, tolerance := range rasterizerTolerances {
+		kind, tolerance := kind, tolerance
+		t.Run(kind.String(), func(t *testing.T) {
+			if kind == RasterizerFT && newFTScanner == nil {
+				t.Skip("requires the gosvg_ft build tag")
+			}
+			for _, p := range goldenIcons {
+				content, err := ioutil.ReadFile(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ref := renderWith(t, content, &Options{Rasterizer: RasterizerCell, Width: 400})
+				got := renderWith(t, content, &Options{Rasterizer: kind, Width: 400})
+
+				small, err := compare.Compare(ref, got, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				large, _ := compare.Compare(ref, got, 32)
+				total := float64(len(ref.Pix) / 4)
+				if float64(small.DifferentPixels) > tolerance.small*total || float64(large.DifferentPixels) > tolerance.large*total || small.SSIM < tolerance.ssim {
+					t.Fatalf("%s: too many differences (%s)", p, small)
+				}
+			}
+		})
+	}
+}
+
+func TestRasterizerFT(t *testing.T) {
+	_, err := RenderWithOptions(context.Background(), strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"/>`),
+		&Options{Rasterizer: RasterizerFT})
+	if available := newFTScanner != nil; available != (err == nil) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestGVScanner(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	sc := newGVScanner(img.Rect)
+	sc.setTarget(img)
+	sc.SetColor(color.RGBA{R: 0xff, A: 0xff})
+	drawNestedSquares(sc)
+	sc.Draw()
+	for _, p := range [...]image.Point{{20, 20}, {50, 50}} {
+		if got := img.RGBAAt(p.X, p.Y).A; got != 0xff {
+			t.Fatalf("expected opaque pixel at %v, got %d", p, got)
+		}
+	}
+	if got := img.RGBAAt(95, 95).A; got != 0 {
+		t.Fatalf("expected transparent pixel, got %d", got)
+	}
+}
+
+func TestGVScannerTarget(t *testing.T) {
+	full := image.NewRGBA(image.Rect(10, 10, 100, 100))
+	part := image.NewRGBA(image.Rect(20, 30, 70, 60))
+	for _, dst := range [...]*image.RGBA{full, part} {
+		// the path is always accumulated in the whole area,
+		// which does not start at (0, 0)
+		sc := newGVScanner(full.Rect)
+		sc.setTarget(dst)
+		sc.SetColor(color.RGBA{B: 0xff, A: 0xff})
+		sc.Start(flToFixed(-5.5, 10.2))
+		sc.Line(flToFixed(80.3, 40.7))
+		sc.Line(flToFixed(40.1, 90.9))
+		sc.Line(flToFixed(-5.5, 10.2))
+		sc.Draw()
+	}
+	assertEqual(t, full.SubImage(part.Rect), part)
+	if got := full.RGBAAt(40, 40).A; got != 0xff {
+		t.Fatalf("expected opaque pixel, got %d", got)
+	}
+}
+
+func TestRasterizerWarnings(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 20" shape-rendering="crispEdges">
+	<rect width="10" height="10"/>
+	</svg>`
+	// the aliased shapes are drawn with RasterizerCell
+	img, warnings, err := RenderWithWarnings(context.Background(), strings.NewReader(src), &Options{Rasterizer: RasterizerGV, Width: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 || countAntialiased(img.(*image.RGBA)) != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+
+	// the SVG parser does not expose the fill-rule property,
+	// so the canvas is used directly: the evenodd fills are drawn with RasterizerCell
+	sess := newSession(context.Background(), Limits{})
+	sess.rasterizer = RasterizerGV
+	dst := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	output := newCanvas(0, 0, 20, 20, dst, nil, sess)
+	output.Rectangle(0, 0, 16, 16)
+	output.Rectangle(4, 4, 8, 8)
+	output.Paint(backend.FillEvenOdd)
+	if warnings := sess.getWarnings(); len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	if a1, a2 := dst.RGBAAt(2, 2).A, dst.RGBAAt(8, 8).A; a1 != 0xff || a2 != 0 {
+		t.Fatalf("unexpected evenodd fill: %d %d", a1, a2)
+	}
+}
@@ -0,0 +1,501 @@
+package gosvg
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/srwiley/rasterx"
+	"golang.org/x/image/math/fixed"
+)
+
+var _ scanner = (*cellScanner)(nil)
+
+// cell stores the contribution of the edges crossing one pixel,
+// in 26.6 fixed point units.
+type cell struct {
+	cover int32 // sum of the (signed) heights of the edges
+	area  int32 // sum of heights x (twice) the average horizontal position of the edges
+}
+
+// edge is a segment, in 26.6 fixed point units, with y0 < y1,
+// going down if dir = 1, up if dir = -1
+type edge struct {
+	x0, y0, x1, y1 int64
+	dir            int32
+}
+
+// crossing is the intersection of an edge with a row of samples
+type crossing struct {
+	x   int64
+	dir int32
+}
+
+// fullCoverage is the value of a pixel entirely covered
+// (one cell crossed by an edge of height 64 at position 0),
+// as computed by cellScanner.Draw
+const fullCoverage = 2 * 64 * 64
+
+// cellScanner is a signed area rasterizer, in the spirit of
+// the FreeType and stb_truetype ones.
+//
+// Contrary to rasterx.ScannerGV, the coverage of each pixel
+// only depends on the absolute coordinates of the edges and is
+// computed with integer arithmetic, row by row.
+// As a consequence, rendering an image in several parts (see `renderTiles`)
+// produces exactly the same pixels as rendering it at once.
+//
+// If `samples` is positive, the edges are stored instead, and the coverage
+// of each pixel is estimated when drawing, with a grid of samples.
+//
+// The points are given in the absolute pixel space, that is the
+// top left cell is at `origin`, which may not be (0, 0).
+// The edges are accumulated in the whole cells area, but only
+// the pixels of `dst`, which may be smaller and may change
+// between two paths (see `Canvas.target`), are drawn.
+type cellScanner struct {
+	dst  *image.RGBA     // may be nil
+	clip image.Rectangle // optional, in absolute pixel space
+
+	cells         []cell   // lazily allocated from `cellsPool`, row major
+	session       *session // accounts the memory of the cells, may be nil
+	origin        image.Point
+	width, height int
+	// range of the rows modified since the last Clear
+	minRow, maxRow int
+
+	// if positive, the number of samples per pixel along each axis,
+	// the value 1 disabling anti-aliasing
+	samples   int
+	edges     []edge // sorted by y0 when drawing
+	active    []edge // edges crossing the current row of samples
+	crossings []crossing
+
+	alphas []uint32 // coverage of the current row, in [0, 0xffff]
+
+	pen    fixed.Point26_6
+	extent fixed.Rectangle26_6
+
+	color     color.Color       // used if colorFunc is nil
+	colorFunc rasterx.ColorFunc // called with absolute pixel coordinates
+	nonZero   bool
+}
+
+// cellsPool stores *[]cell, whose elements are all zero,
+// so that the memory used by a path is recycled once it is drawn.
+var cellsPool sync.Pool
+
+// cellsSize is the memory used by `n` cells
+func cellsSize(n int) int64 { return 8 * int64(n) }
+
+func getCells(n int) []cell {
+	if p, ok := cellsPool.Get().(*[]cell); ok && cap(*p) >= n {
+		return (*p)[:n]
+	} // else the slice is too small and is dropped
+	return make([]cell, n)
+}
+
+// newCellScanner returns a scanner accumulating the edges in `bounds`,
+// with the given number of samples (see `cellScanner.samples`).
+// The memory of the cells is accounted in `sess`, which may be nil.
+// `setTarget` must be called before `Draw`.
+func newCellScanner(bounds image.Rectangle, sess *session, samples int) *cellScanner {
+	sc := &cellScanner{origin: bounds.Min, session: sess, color: color.Black, nonZero: true, samples: samples}
+	sc.SetBounds(bounds.Dx(), bounds.Dy())
+	return sc
+}
+
+// setTarget sets the image modified by `Draw`, whose bounds
+// should be included in the cells area.
+func (sc *cellScanner) setTarget(dst *image.RGBA) { sc.dst = dst }
+
+// SetBounds sets the size of the cells area, and calls Clear.
+func (sc *cellScanner) SetBounds(width, height int) {
+	sc.Clear()
+	sc.width, sc.height = width, height
+	sc.minRow = height
+}
+
+// Clear cancels any previous accumulated edges,
+// and releases the cells.
+func (sc *cellScanner) Clear() {
+	if sc.cells != nil && sc.minRow < sc.maxRow {
+		row := sc.cells[sc.minRow*sc.width : sc.maxRow*sc.width]
+		for i := range row {
+			row[i] = cell{}
+		}
+	}
+	if sc.cells != nil {
+		// the pool must not reference the field itself
+		cells := sc.cells
+		cellsPool.Put(&cells)
+		sc.cells = nil
+		sc.session.releaseBytes(cellsSize(sc.width * sc.height))
+	}
+	sc.edges = sc.edges[:0]
+	sc.minRow, sc.maxRow = sc.height, 0
+	sc.extent = emptyExtent()
+}
+
+// SetColor accepts a color.Color or a rasterx.ColorFunc
+func (sc *cellScanner) SetColor(c interface{}) {
+	switch c := c.(type) {
+	case color.Color:
+		sc.color, sc.colorFunc = c, nil
+	case rasterx.ColorFunc:
+		sc.colorFunc = c
+	}
+}
+
+func (sc *cellScanner) SetWinding(useNonZeroWinding bool) { sc.nonZero = useNonZeroWinding }
+
+func (sc *cellScanner) SetClip(rect image.Rectangle) { sc.clip = rect }
+
+func (sc *cellScanner) GetPathExtent() fixed.Rectangle26_6 { return sc.extent }
+
+// emptyExtent returns the extent of an empty path,
+// with the same sentinel values as rasterx
+func emptyExtent() fixed.Rectangle26_6 {
+	const mxfi = fixed.Int26_6(math.MaxInt32)
+	return fixed.Rectangle26_6{Min: fixed.Point26_6{X: mxfi, Y: mxfi}, Max: fixed.Point26_6{X: -mxfi, Y: -mxfi}}
+}
+
+// growExtent extends `extent` to include `p`
+func growExtent(extent *fixed.Rectangle26_6, p fixed.Point26_6) {
+	if p.X < extent.Min.X {
+		extent.Min.X = p.X
+	}
+	if p.Y < extent.Min.Y {
+		extent.Min.Y = p.Y
+	}
+	if p.X > extent.Max.X {
+		extent.Max.X = p.X
+	}
+	if p.Y > extent.Max.Y {
+		extent.Max.Y = p.Y
+	}
+}
+
+// Start moves the current point to `a`.
+// As rasterx.ScannerGV, the previous sub-path is not closed.
+func (sc *cellScanner) Start(a fixed.Point26_6) {
+	sc.pen = a
+	growExtent(&sc.extent, a)
+}
+
+// Line adds an edge from the current point to `b`.
+func (sc *cellScanner) Line(b fixed.Point26_6) {
+	growExtent(&sc.extent, b)
+	sc.addEdge(sc.pen, b)
+	sc.pen = b
+}
+
+// floorDiv returns floor(a / b)
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// ceilDiv returns ceil(a / b)
+func ceilDiv(a, b int64) int64 { return -floorDiv(-a, b) }
+
+func abs64(a int64) int64 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func (sc *cellScanner) addEdge(a, b fixed.Point26_6) {
+	if a.Y == b.Y { // horizontal edges do not change the coverage
+		return
+	}
+	var dir int32 = 1
+	if a.Y > b.Y {
+		a, b, dir = b, a, -1
+	}
+
+	origin := sc.origin
+	x0, y0, x1, y1 := int64(a.X), int64(a.Y), int64(b.X), int64(b.Y)
+	// the x coordinate of the edge at y, which only depends
+	// on the absolute coordinates of the edge
+	xAt := func(y int64) int64 {
+		if y == y0 {
+			return x0
+		} else if y == y1 {
+			return x1
+		}
+		return x0 + floorDiv((y-y0)*(x1-x0), y1-y0)
+	}
+
+	rowStart, rowEnd := floorDiv(y0, 64), floorDiv(y1+63, 64)
+	if min := int64(origin.Y); rowStart < min {
+		rowStart = min
+	}
+	if max := int64(origin.Y + sc.height); rowEnd > max {
+		rowEnd = max
+	}
+	if rowStart >= rowEnd {
+		return
+	}
+
+	if sc.samples > 0 { // the coverage is computed when drawing
+		sc.edges = append(sc.edges, edge{x0, y0, x1, y1, dir})
+		sc.markRows(int(rowStart)-origin.Y, int(rowEnd)-origin.Y)
+		return
+	}
+
+	if sc.cells == nil {
+		if !sc.session.allocBytes(cellsSize(sc.width * sc.height)) {
+			return // the session is failed
+		}
+		sc.cells = getCells(sc.width * sc.height)
+	}
+	for row := rowStart; row < rowEnd; row++ {
+		ya, yb := row*64, (row+1)*64
+		if ya < y0 {
+			ya = y0
+		}
+		if yb > y1 {
+			yb = y1
+		}
+		if ya >= yb {
+			continue
+		}
+		r := int(row) - origin.Y
+		sc.addRowEdge(sc.cells[r*sc.width:(r+1)*sc.width], xAt(ya), ya, xAt(yb), yb, dir)
+		sc.markRows(r, r+1)
+	}
+}
+
+// markRows extends the range of the modified rows with [start, end)
+func (sc *cellScanner) markRows(start, end int) {
+	if start < sc.minRow {
+		sc.minRow = start
+	}
+	if end > sc.maxRow {
+		sc.maxRow = end
+	}
+}
+
+// addRowEdge adds the edge from (xa, ya) to (xb, yb), contained in one row,
+// with ya < yb, and going down if dir = 1, up if dir = -1
+func (sc *cellScanner) addRowEdge(cells []cell, xa, ya, xb, yb int64, dir int32) {
+	left, right := int64(sc.origin.X)*64, int64(sc.origin.X+sc.width)*64
+	// the y coordinate of the edge at x, which only depends on
+	// the end points of the edge (and not on the clipping)
+	x0, y0, x1, y1 := xa, ya, xb, yb
+	yAt := func(x int64) int64 {
+		if x == x0 {
+			return y0
+		} else if x == x1 {
+			return y1
+		}
+		return y0 + floorDiv((x-x0)*(y1-y0), x1-x0)
+	}
+
+	// clip to the left: the part of the edge outside the target
+	// covers entirely the pixels of the row
+	if xa < left && xb < left {
+		cells[0].cover += dir * int32(yb-ya)
+		return
+	} else if xa < left {
+		yl := yAt(left)
+		cells[0].cover += dir * int32(yl-ya)
+		xa, ya = left, yl
+	} else if xb < left {
+		yl := yAt(left)
+		cells[0].cover += dir * int32(yb-yl)
+		xb, yb = left, yl
+	}
+	// clip to the right: the part of the edge outside the target
+	// has no effect on the pixels of the row
+	if xa >= right && xb >= right {
+		return
+	} else if xa > right {
+		xa, ya = right, yAt(right)
+	} else if xb > right {
+		xb, yb = right, yAt(right)
+	}
+
+	// walk the cells from left to right
+	if xa > xb {
+		xa, ya, xb, yb = xb, yb, xa, ya
+	}
+	for {
+		col := floorDiv(xa, 64)
+		xNext, yNext := xb, yb
+		if boundary := (col + 1) * 64; xb > boundary {
+			xNext, yNext = boundary, yAt(boundary)
+		}
+		if i := int(col) - sc.origin.X; i < sc.width {
+			dy := dir * int32(abs64(yNext-ya))
+			cells[i].cover += dy
+			cells[i].area += dy * int32(xa+xNext-2*col*64)
+		}
+		if xNext == xb {
+			break
+		}
+		xa, ya = xNext, yNext
+	}
+}
+
+// Draw renders the accumulated edges onto the target.
+func (sc *cellScanner) Draw() {
+	if sc.minRow >= sc.maxRow || sc.dst == nil {
+		return
+	}
+	bounds := sc.dst.Rect
+	if sc.clip != (image.Rectangle{}) {
+		bounds = bounds.Intersect(sc.clip)
+	}
+	if cap(sc.alphas) < sc.width {
+		sc.alphas = make([]uint32, sc.width)
+	}
+	alphas := sc.alphas[:sc.width]
+	if sc.samples > 0 {
+		sort.Slice(sc.edges, func(i, j int) bool { return sc.edges[i].y0 < sc.edges[j].y0 })
+		sc.active = sc.active[:0]
+	}
+
+	var sr, sg, sb, sa uint32
+	if sc.colorFunc == nil {
+		sr, sg, sb, sa = sc.color.RGBA()
+	}
+	nextEdge := 0 // index of the first edge not yet active
+	for r := sc.minRow; r < sc.maxRow; r++ {
+		y := sc.origin.Y + r
+		if y < bounds.Min.Y || y >= bounds.Max.Y {
+			continue
+		}
+		if sc.samples > 0 {
+			nextEdge = sc.sampleRow(y, nextEdge, alphas)
+		} else {
+			sc.areaRow(r, alphas)
+		}
+		for i, ma := range alphas {
+			x := sc.origin.X + i
+			if ma == 0 || x < bounds.Min.X || x >= bounds.Max.X {
+				continue
+			}
+			if sc.colorFunc != nil {
+				sr, sg, sb, sa = sc.colorFunc(x, y).RGBA()
+			}
+			i := sc.dst.PixOffset(x, y)
+			blendPixel(sc.dst.Pix[i:i+4:i+4], sr, sg, sb, sa, ma)
+		}
+	}
+}
+
+// areaRow computes the coverage of the pixels of the
+// row `r` (relative to the origin), from the cells
+func (sc *cellScanner) areaRow(r int, alphas []uint32) {
+	cells := sc.cells[r*sc.width : (r+1)*sc.width]
+	var acc int32
+	for i, c := range cells {
+		v := 128*(acc+c.cover) - c.area
+		acc += c.cover
+		alphas[i] = sc.coverageToAlpha(v)
+	}
+}
+
+// sampleRow computes the coverage of the pixels of the row `y`,
+// with samples x samples points per pixel, at the center of a regular grid.
+// The rows must be sampled from top to bottom, `nextEdge` being
+// the index of the first edge not yet active, which is updated and returned.
+//
+// To use integer sample positions, the coordinates are scaled by 2*samples:
+// the center of the sample (i, j) (in the whole image) is then at (64(2i+1), 64(2j+1)).
+func (sc *cellScanner) sampleRow(y, nextEdge int, alphas []uint32) int {
+	n := int64(sc.samples)
+	scale := 2 * n
+	for i := range alphas {
+		alphas[i] = 0
+	}
+	colMin, colMax := int64(sc.origin.X)*n, int64(sc.origin.X+sc.width)*n
+	for k := int64(0); k < n; k++ {
+		ys := 64*int64(y)*scale + 64*(2*k+1)
+
+		// update the active edges
+		for ; nextEdge < len(sc.edges) && sc.edges[nextEdge].y0*scale <= ys; nextEdge++ {
+			sc.active = append(sc.active, sc.edges[nextEdge])
+		}
+		active := sc.active[:0]
+		sc.crossings = sc.crossings[:0]
+		for _, e := range sc.active {
+			if e.y1*scale <= ys {
+				continue
+			}
+			active = append(active, e)
+			x := e.x0*scale + floorDiv((ys-e.y0*scale)*(e.x1-e.x0), e.y1-e.y0)
+			sc.crossings = append(sc.crossings, crossing{x, e.dir})
+		}
+		sc.active = active
+
+		// insertion sort, since there are usually only a few crossings
+		crossings := sc.crossings
+		for i := 1; i < len(crossings); i++ {
+			for j := i; j > 0 && crossings[j].x < crossings[j-1].x; j-- {
+				crossings[j], crossings[j-1] = crossings[j-1], crossings[j]
+			}
+		}
+
+		var winding int32
+		for i := 0; i+1 < len(crossings); i++ {
+			winding += crossings[i].dir
+			if !sc.isInside(winding) {
+				continue
+			}
+			// the samples in [crossings[i].x, crossings[i+1].x)
+			start, end := ceilDiv(crossings[i].x-64, 128), ceilDiv(crossings[i+1].x-64, 128)
+			if start < colMin {
+				start = colMin
+			}
+			if end > colMax {
+				end = colMax
+			}
+			for col := start; col < end; col++ {
+				alphas[(col-colMin)/n]++
+			}
+		}
+	}
+
+	total := uint32(n * n)
+	for i, count := range alphas {
+		alphas[i] = count * 0xffff / total
+	}
+	return nextEdge
+}
+
+// isInside returns true if a point with the given
+// winding number is inside the path
+func (sc *cellScanner) isInside(winding int32) bool {
+	if sc.nonZero {
+		return winding != 0
+	}
+	return winding&1 != 0
+}
+
+// coverageToAlpha maps a signed area to an alpha value in [0, 0xffff],
+// according to the winding rule
+func (sc *cellScanner) coverageToAlpha(v int32) uint32 {
+	if v < 0 {
+		v = -v
+	}
+	if sc.nonZero {
+		if v > fullCoverage {
+			v = fullCoverage
+		}
+	} else {
+		v %= 2 * fullCoverage
+		if v > fullCoverage {
+			v = 2*fullCoverage - v
+		}
+	}
+	return uint32(v) * 0xffff / fullCoverage
+}
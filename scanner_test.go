@@ -0,0 +1,145 @@
+package gosvg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// two nested squares, with the same orientation
+func drawNestedSquares(sc scanner) {
+	for _, sq := range [2][2]Fl{{10, 80}, {30, 40}} {
+		x, w := sq[0], sq[1]
+		sc.Start(flToFixed(x, x))
+		sc.Line(flToFixed(x+w, x))
+		sc.Line(flToFixed(x+w, x+w))
+		sc.Line(flToFixed(x, x+w))
+		sc.Line(flToFixed(x, x))
+	}
+}
+
+func TestCellScannerWinding(t *testing.T) {
+	for _, samples := range []int{0, 4} {
+		for _, nonZero := range []bool{true, false} {
+			img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+			sc := newCellScanner(img.Rect, nil, samples)
+			sc.setTarget(img)
+			sc.SetColor(color.RGBA{R: 0xff, A: 0xff})
+			sc.SetWinding(nonZero)
+			drawNestedSquares(sc)
+			sc.Draw()
+
+			if got := img.RGBAAt(20, 20).A; got != 0xff {
+				t.Fatalf("expected opaque pixel, got %d", got)
+			}
+			if got := img.RGBAAt(95, 95).A; got != 0 {
+				t.Fatalf("expected transparent pixel, got %d", got)
+			}
+			inside := img.RGBAAt(50, 50).A
+			if nonZero && inside != 0xff {
+				t.Fatalf("expected opaque pixel, got %d", inside)
+			} else if !nonZero && inside != 0 {
+				t.Fatalf("expected transparent pixel, got %d", inside)
+			}
+		}
+	}
+}
+
+func TestCellScannerAntialiasing(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	sc := newCellScanner(img.Rect, nil, 0)
+	sc.setTarget(img)
+	sc.SetColor(color.RGBA{A: 0xff})
+	// half a pixel wide vertical band
+	sc.Start(flToFixed(2, 0))
+	sc.Line(flToFixed(2.5, 0))
+	sc.Line(flToFixed(2.5, 10))
+	sc.Line(flToFixed(2, 10))
+	sc.Line(flToFixed(2, 0))
+	sc.Draw()
+
+	if got := img.RGBAAt(2, 5).A; got != 0x7f {
+		t.Fatalf("expected half covered pixel, got %d", got)
+	}
+	if got := img.RGBAAt(3, 5).A; got != 0 {
+		t.Fatalf("expected transparent pixel, got %d", got)
+	}
+}
+
+func TestCellScannerOrigin(t *testing.T) {
+	for _, samples := range []int{0, 1, 4} {
+		full := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		parts := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		draw := func(dst *image.RGBA) {
+			sc := newCellScanner(dst.Rect, nil, samples)
+			sc.setTarget(dst)
+			sc.SetColor(color.RGBA{G: 0xff, A: 0xff})
+			sc.Start(flToFixed(-10.3, 20.7))
+			sc.Line(flToFixed(90.1, 50.2))
+			sc.Line(flToFixed(130.3, 95.9))
+			sc.Line(fixed.Point26_6{X: -659, Y: 1324})
+			sc.Draw()
+		}
+		draw(full)
+		for _, r := range tileRects(parts.Rect, 33) {
+			draw(parts.SubImage(r).(*image.RGBA))
+		}
+		assertEqual(t, full, parts)
+	}
+}
+
+// adds a vertical band, from x0 to x1
+func drawBand(sc *cellScanner, x0, x1 Fl) {
+	sc.Start(flToFixed(x0, 0))
+	sc.Line(flToFixed(x1, 0))
+	sc.Line(flToFixed(x1, 10))
+	sc.Line(flToFixed(x0, 10))
+	sc.Line(flToFixed(x0, 0))
+}
+
+func TestCellScannerSamples(t *testing.T) {
+	// aliased
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	sc := newCellScanner(img.Rect, nil, 1)
+	sc.setTarget(img)
+	drawBand(sc, 2.4, 4.6)
+	sc.Draw()
+	for x, exp := range []uint8{0, 0, 0xff, 0xff, 0xff, 0, 0} {
+		if got := img.RGBAAt(x, 5).A; got != exp {
+			t.Fatalf("pixel %d: expected %d, got %d", x, exp, got)
+		}
+	}
+
+	// the exact area counts twice the overlapping parts,
+	// while the samples are only counted once
+	for samples, exp := range map[int]uint8{0: 0xff, 4: 0x7f} {
+		img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+		sc := newCellScanner(img.Rect, nil, samples)
+		sc.setTarget(img)
+		drawBand(sc, 2, 2.5)
+		drawBand(sc, 2, 2.5)
+		sc.Draw()
+		if got := img.RGBAAt(2, 5).A; got != exp {
+			t.Fatalf("samples %d: expected %d, got %d", samples, exp, got)
+		}
+	}
+}
+
+func TestCellScannerTarget(t *testing.T) {
+	full := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	part := image.NewRGBA(image.Rect(20, 30, 70, 60))
+	for _, dst := range [...]*image.RGBA{full, part} {
+		// the edges are always accumulated in the whole area
+		sc := newCellScanner(full.Rect, nil, 0)
+		sc.setTarget(dst)
+		sc.SetColor(color.RGBA{B: 0xff, A: 0xff})
+		sc.Start(flToFixed(-5.5, 10.2))
+		sc.Line(flToFixed(80.3, 40.7))
+		sc.Line(flToFixed(40.1, 90.9))
+		sc.Line(flToFixed(-5.5, 10.2))
+		sc.Draw()
+	}
+	assertEqual(t, full.SubImage(part.Rect), part)
+}
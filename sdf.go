@@ -0,0 +1,262 @@
+package gosvg
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/benoitkugler/webrender/backend"
+	"golang.org/x/image/math/fixed"
+)
+
+// DistanceField is a signed distance field of the shapes of an image,
+// computed from their geometry (see Options.DistanceFieldSpread).
+// It is an image.Image, whose gray levels map the distances
+// from -Spread (black) to Spread (white), the edges being mid-gray.
+type DistanceField struct {
+	Rect image.Rectangle
+	// Distances are the distances, in pixels, from the center of
+	// each pixel to the closest edge, positive inside the shapes and
+	// clamped to [-Spread, Spread]. They are stored in row major order.
+	Distances []float32
+	Spread    Fl
+}
+
+// DistanceAt returns the distance of the pixel (x, y),
+// or -Spread outside of Rect.
+func (f *DistanceField) DistanceAt(x, y int) float32 {
+	if !(image.Point{x, y}.In(f.Rect)) {
+		return -float32(f.Spread)
+	}
+	return f.Distances[(y-f.Rect.Min.Y)*f.Rect.Dx()+x-f.Rect.Min.X]
+}
+
+func (f *DistanceField) ColorModel() color.Model { return color.GrayModel }
+
+func (f *DistanceField) Bounds() image.Rectangle { return f.Rect }
+
+func (f *DistanceField) At(x, y int) color.Color {
+	return color.Gray{Y: f.grayLevel(f.DistanceAt(x, y))}
+}
+
+func (f *DistanceField) grayLevel(d float32) uint8 {
+	v := (d/float32(f.Spread) + 1) * 0xff / 2
+	return uint8(clamp255(v) + 0.5)
+}
+
+// Gray returns the field as a gray image, which is
+// what most shaders expect.
+func (f *DistanceField) Gray() *image.Gray {
+	out := image.NewGray(f.Rect)
+	for i, d := range f.Distances {
+		out.Pix[i] = f.grayLevel(d)
+	}
+	return out
+}
+
+// sdfEdge is a line segment, in device space
+type sdfEdge struct {
+	x0, y0, x1, y1 float64
+}
+
+// distance returns the distance from (x, y) to the segment
+func (e sdfEdge) distance(x, y float64) float64 {
+	dx, dy := e.x1-e.x0, e.y1-e.y0
+	t := 0.
+	if l2 := dx*dx + dy*dy; l2 > 0 {
+		t = math.Max(0, math.Min(1, ((x-e.x0)*dx+(y-e.y0)*dy)/l2))
+	}
+	return math.Hypot(x-(e.x0+t*dx), y-(e.y0+t*dy))
+}
+
+// sdfShape is a filled or stroked path, recorded by Canvas.Paint
+// for the distance fields.
+type sdfShape struct {
+	edges []sdfEdge // the closed contours of the fills, the sub-paths of the strokes
+
+	fill    bool
+	evenOdd bool
+	// for the strokes, which are approximated with
+	// round caps and joins, ignoring the dashes
+	halfWidth float64
+
+	minX, minY, maxX, maxY float64 // of the edges, extended by halfWidth
+}
+
+// signedDistance returns the distance from (x, y) to the edge of the
+// shape, positive inside, clamped to [-limit, limit]
+func (s *sdfShape) signedDistance(x, y, limit float64) float64 {
+	// distance to the bounding box
+	dx := math.Max(0, math.Max(s.minX-x, x-s.maxX))
+	dy := math.Max(0, math.Max(s.minY-y, y-s.maxY))
+	if math.Hypot(dx, dy) >= limit {
+		return -limit
+	}
+
+	d := limit + s.halfWidth
+	for _, e := range s.edges {
+		d = math.Min(d, e.distance(x, y))
+	}
+	if !s.fill {
+		return math.Max(-limit, math.Min(limit, s.halfWidth-d))
+	}
+	d = math.Min(d, limit)
+	if s.contains(x, y) {
+		return d
+	}
+	return -d
+}
+
+// contains applies the fill rule at (x, y)
+func (s *sdfShape) contains(x, y float64) bool {
+	var winding int
+	for _, e := range s.edges {
+		if (e.y0 <= y) == (e.y1 <= y) {
+			continue
+		}
+		// the edge crosses the horizontal line at y
+		if xi := e.x0 + (y-e.y0)*(e.x1-e.x0)/(e.y1-e.y0); xi > x {
+			if e.y1 > e.y0 {
+				winding++
+			} else {
+				winding--
+			}
+		}
+	}
+	if s.evenOdd {
+		return winding&1 != 0
+	}
+	return winding != 0
+}
+
+// flattenTolerance is the maximum distance, in pixels, between
+// the curves and the segments approximating them
+const flattenTolerance = 0.05
+
+// sdfFlattener is a rasterx.Adder approximating the
+// curves of a path with line segments
+type sdfFlattener struct {
+	shape      *sdfShape
+	start, pen [2]float64
+	hasEdges   bool // since start
+}
+
+func fixedToFloat(p fixed.Point26_6) [2]float64 {
+	return [2]float64{float64(p.X) / 64, float64(p.Y) / 64}
+}
+
+func (f *sdfFlattener) Start(a fixed.Point26_6) {
+	f.start, f.pen, f.hasEdges = fixedToFloat(a), fixedToFloat(a), false
+}
+
+func (f *sdfFlattener) lineTo(p [2]float64) {
+	f.shape.edges = append(f.shape.edges, sdfEdge{f.pen[0], f.pen[1], p[0], p[1]})
+	f.pen, f.hasEdges = p, true
+}
+
+func (f *sdfFlattener) Line(b fixed.Point26_6) { f.lineTo(fixedToFloat(b)) }
+
+func (f *sdfFlattener) QuadBezier(b, c fixed.Point26_6) {
+	p0, p1, p2 := f.pen, fixedToFloat(b), fixedToFloat(c)
+	n := curveSteps(2 * secondDifference(p0, p1, p2))
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		f.lineTo([2]float64{
+			u*u*p0[0] + 2*u*t*p1[0] + t*t*p2[0],
+			u*u*p0[1] + 2*u*t*p1[1] + t*t*p2[1],
+		})
+	}
+}
+
+func (f *sdfFlattener) CubeBezier(b, c, d fixed.Point26_6) {
+	p0, p1, p2, p3 := f.pen, fixedToFloat(b), fixedToFloat(c), fixedToFloat(d)
+	n := curveSteps(6 * math.Max(secondDifference(p0, p1, p2), secondDifference(p1, p2, p3)))
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		f.lineTo([2]float64{
+			u*u*u*p0[0] + 3*u*u*t*p1[0] + 3*u*t*t*p2[0] + t*t*t*p3[0],
+			u*u*u*p0[1] + 3*u*u*t*p1[1] + 3*u*t*t*p2[1] + t*t*t*p3[1],
+		})
+	}
+}
+
+// Stop ends the current sub-path. The isolated points are kept
+// as empty edges, since they are drawn by the round caps.
+func (f *sdfFlattener) Stop(closeLoop bool) {
+	if closeLoop && f.pen != f.start {
+		f.lineTo(f.start)
+	} else if !f.hasEdges && !f.shape.fill {
+		f.lineTo(f.start)
+	}
+	f.pen, f.hasEdges = f.start, false
+}
+
+// secondDifference returns |a - 2b + c|
+func secondDifference(a, b, c [2]float64) float64 {
+	return math.Hypot(a[0]-2*b[0]+c[0], a[1]-2*b[1]+c[1])
+}
+
+// curveSteps returns the number of segments approximating a curve
+// whose second derivative is bounded by `maxDerivative`, within flattenTolerance:
+// the distance between a chord and the curve is at most maxDerivative / (8 n²).
+func curveSteps(maxDerivative float64) int {
+	n := math.Ceil(math.Sqrt(maxDerivative / (8 * flattenTolerance)))
+	return int(math.Max(1, math.Min(256, n)))
+}
+
+// recordShape stores the current path, painted with `op`,
+// for the distance field.
+func (cv *Canvas) recordShape(op backend.PaintOp) {
+	if op&(backend.FillEvenOdd|backend.FillNonZero) != 0 {
+		shape := sdfShape{fill: true, evenOdd: op&backend.FillNonZero == 0}
+		cv.path.addTo(&sdfFlattener{shape: &shape}, cv.pathMat, true)
+		cv.addShape(shape)
+	}
+	if op&backend.Stroke != 0 {
+		shape := sdfShape{halfWidth: float64(cv.state.strokeOptions.strokeWidth) / 128}
+		cv.path.addTo(&sdfFlattener{shape: &shape}, cv.pathMat, false)
+		cv.addShape(shape)
+	}
+}
+
+func (cv *Canvas) addShape(shape sdfShape) {
+	if len(shape.edges) == 0 {
+		return
+	}
+	shape.minX, shape.minY = math.Inf(1), math.Inf(1)
+	shape.maxX, shape.maxY = math.Inf(-1), math.Inf(-1)
+	for _, e := range shape.edges {
+		shape.minX = math.Min(shape.minX, math.Min(e.x0, e.x1))
+		shape.minY = math.Min(shape.minY, math.Min(e.y0, e.y1))
+		shape.maxX = math.Max(shape.maxX, math.Max(e.x0, e.x1))
+		shape.maxY = math.Max(shape.maxY, math.Max(e.y0, e.y1))
+	}
+	shape.minX, shape.minY = shape.minX-shape.halfWidth, shape.minY-shape.halfWidth
+	shape.maxX, shape.maxY = shape.maxX+shape.halfWidth, shape.maxY+shape.halfWidth
+	cv.shapes = append(cv.shapes, shape)
+}
+
+// newDistanceField computes the field of the union of `shapes`,
+// approximated by the maximum of their signed distances.
+// The cost is O(pixels × edges) in the worst case, only bounded
+// by the context of `sess`, which is checked for each row.
+func newDistanceField(r image.Rectangle, shapes []sdfShape, spread Fl, sess *session) *DistanceField {
+	out := &DistanceField{Rect: r, Distances: make([]float32, r.Dx()*r.Dy()), Spread: spread}
+	limit := float64(spread)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		if !sess.checkContext() {
+			break
+		}
+		row := out.Distances[(y-r.Min.Y)*r.Dx():]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			d := -limit
+			for i := range shapes {
+				d = math.Max(d, shapes[i].signedDistance(float64(x)+0.5, float64(y)+0.5, limit))
+			}
+			row[x-r.Min.X] = float32(d)
+		}
+	}
+	return out
+}
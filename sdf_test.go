@@ -0,0 +1,130 @@
+package gosvg
+
+import (
+	"context"
+	"image"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/benoitkugler/webrender/backend"
+)
+
+func renderDistanceField(t *testing.T, src string, spread Fl) (*DistanceField, []Warning) {
+	t.Helper()
+	img, warnings, err := RenderWithWarnings(context.Background(), strings.NewReader(src), &Options{DistanceFieldSpread: spread})
+	if err != nil {
+		t.Fatal(err)
+	}
+	field, ok := img.(*DistanceField)
+	if !ok {
+		t.Fatalf("unexpected image type %T", img)
+	}
+	return field, warnings
+}
+
+func assertDistance(t *testing.T, field *DistanceField, x, y int, exp, tolerance float64) {
+	t.Helper()
+	if got := float64(field.DistanceAt(x, y)); math.Abs(got-exp) > tolerance {
+		t.Fatalf("at (%d, %d): expected %g, got %g", x, y, exp, got)
+	}
+}
+
+func TestDistanceFieldCircle(t *testing.T) {
+	field, _ := renderDistanceField(t, `<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64">
+		<circle cx="32" cy="32" r="20"/>
+	</svg>`, 8)
+	if field.Rect != image.Rect(0, 0, 64, 64) {
+		t.Fatalf("unexpected bounds %v", field.Rect)
+	}
+	// the distances to the center of the pixels, the cubic curves
+	// drawn by the svg package slightly deviating from the circle
+	assertDistance(t, field, 52, 31, 20-math.Hypot(20.5, 0.5), 0.05)
+	assertDistance(t, field, 46, 31, 20-math.Hypot(14.5, 0.5), 0.05)
+	assertDistance(t, field, 32, 32, 8, 0.02)
+	assertDistance(t, field, 0, 0, -8, 0.02)
+
+	gray := field.Gray()
+	if v := gray.GrayAt(52, 31).Y; v < 116 || v > 128 {
+		t.Fatalf("unexpected edge level %d", v)
+	}
+	if gray.GrayAt(32, 32).Y != 0xff || gray.GrayAt(0, 0).Y != 0 {
+		t.Fatal("unexpected levels")
+	}
+	if field.At(52, 31) != gray.At(52, 31) {
+		t.Fatal("inconsistent At")
+	}
+}
+
+func TestDistanceFieldShapes(t *testing.T) {
+	field, _ := renderDistanceField(t, `<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64">
+		<line x1="10" y1="10" x2="50" y2="10" stroke="black" stroke-width="4"/>
+		<path d="M10 20h40v40h-40z M20 30v20h20v-20z"/>
+	</svg>`, 4)
+	// the stroke is 2 pixels around the line
+	assertDistance(t, field, 30, 11, 0.5, 0.02)
+	assertDistance(t, field, 30, 10, 1.5, 0.02)
+	// with round caps
+	assertDistance(t, field, 8, 10, 2-math.Hypot(1.5, 0.5), 0.02)
+
+	// the hole of the ring
+	assertDistance(t, field, 30, 40, -4, 0.02)
+	assertDistance(t, field, 21, 40, -1.5, 0.02)
+	assertDistance(t, field, 15, 40, 4, 0.02)
+	assertDistance(t, field, 12, 40, 2.5, 0.02)
+
+	// the overlapping shapes are merged
+	field, _ = renderDistanceField(t, `<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64">
+		<g opacity="0.5">
+			<rect x="0" y="0" width="32" height="64"/>
+			<rect x="30" y="0" width="34" height="64" fill="red"/>
+		</g>
+	</svg>`, 16)
+	assertDistance(t, field, 31, 32, 1.5, 0.02)
+	assertDistance(t, field, 16, 32, 15.5, 0.02)
+
+	// no pixels are drawn, even for the masks
+	field, _ = renderDistanceField(t, `<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64">
+		<mask id="m"><rect width="32" height="64" fill="white"/></mask>
+		<rect width="64" height="64" mask="url(#m)"/>
+	</svg>`, 16)
+	assertDistance(t, field, 32, 32, 16, 0.02)
+}
+
+// newDistanceFieldCanvas returns a canvas recording its shapes
+func newDistanceFieldCanvas(size int) (*Canvas, *session) {
+	sess := newSession(context.Background(), Limits{})
+	sess.distanceField = true
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	return newCanvas(0, 0, Fl(size), Fl(size), img, nil, sess), sess
+}
+
+func TestDistanceFieldFillRule(t *testing.T) {
+	for _, op := range []backend.PaintOp{backend.FillEvenOdd, backend.FillNonZero} {
+		cv, sess := newDistanceFieldCanvas(32)
+		// two squares with the same orientation
+		cv.Rectangle(0, 0, 32, 32)
+		cv.Rectangle(8, 8, 16, 16)
+		cv.Paint(op)
+		if len(cv.path) != 0 || len(cv.shapes) != 1 {
+			t.Fatal("expected one recorded shape")
+		}
+		field := newDistanceField(image.Rect(0, 0, 32, 32), cv.shapes, 4, sess)
+		if inside := field.DistanceAt(16, 16) > 0; inside != (op == backend.FillNonZero) {
+			t.Fatalf("unexpected distance %g for %d", field.DistanceAt(16, 16), op)
+		}
+		for _, v := range cv.state.image.Pix {
+			if v != 0 {
+				t.Fatal("the shapes should not be rasterized")
+			}
+		}
+	}
+}
+
+func TestDistanceFieldWarnings(t *testing.T) {
+	cv, sess := newDistanceFieldCanvas(16)
+	cv.drawImage(image.NewRGBA(image.Rect(0, 0, 2, 2)), 16, 16, "")
+	if warnings := sess.getWarnings(); len(warnings) != 1 || warnings[0].Feature != "distance-field" {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}
@@ -0,0 +1,151 @@
+package gosvg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/benoitkugler/textlayout/pango"
+)
+
+// session stores the state shared by all the canvas
+// used for one rendering: configuration, resources usage
+// and the first error encountered.
+// It is safe for concurrent use, since tiles may be rendered
+// in parallel.
+// A nil session is valid, and means no limit.
+type session struct {
+	// accessed atomically, first to be 64-bit aligned
+	layerBytes int64 // memory currently used by the layers
+	segments   int64 // largest number of path segments drawn by a canvas
+
+	ctx    context.Context
+	limits Limits
+	budget *memoryBudget // shared by a batch, may be nil
+
+	samples          int         // see cellScanner.samples, for the root state
+	shapeRendering   bool        // see AntialiasAuto
+	rasterizer       Rasterizer  // see Options.Rasterizer
+	paintOrder       paintOrder  // see Options.PaintOrder
+	followPaintOrder bool        // the paint-order property of the elements is used
+	nonScalingStroke bool        // see Options.NonScalingStroke
+	stroke           strokeStyle // see Options.Stroke
+	dither           Dithering   // see Options.Dither
+	colorSpace       ColorSpace  // see Options.ColorSpace
+	strict           bool        // see Options.Strict
+	glyphs           *glyphCache // see Fonts, may be nil
+	withoutFonts     bool        // the text is laid out but not drawn
+	distanceField    bool        // see Options.DistanceFieldSpread
+
+	mu sync.Mutex
+	// once set, the drawing operations are skipped
+	// and the error is returned to the caller
+	err      error
+	warnings []Warning
+	fonts    map[pango.Font]*textFont // registered by Canvas.AddFont
+}
+
+func newSession(ctx context.Context, limits Limits) *session {
+	return &session{ctx: ctx, limits: limits}
+}
+
+// antialiasing returns the number of samples used by the scanners
+func (s *session) antialiasing() int {
+	if s == nil {
+		return 0
+	}
+	return s.samples
+}
+
+// rasterizerKind returns the algorithm used by the scanners
+func (s *session) rasterizerKind() Rasterizer {
+	if s == nil {
+		return RasterizerGV
+	}
+	return s.rasterizer
+}
+
+// rootPaintOrder returns the order in which the shapes
+// are filled and stroked, before any paint-order property
+func (s *session) rootPaintOrder() paintOrder {
+	if s == nil {
+		return paintOrder{}
+	}
+	return s.paintOrder
+}
+
+// isNonScalingStroke returns true if the stroke width is not transformed
+func (s *session) isNonScalingStroke() bool { return s != nil && s.nonScalingStroke }
+
+// strokeStyle returns the stroking features not exposed by the backend
+func (s *session) strokeStyle() strokeStyle {
+	if s == nil {
+		return defaultStrokeStyle
+	}
+	return s.stroke
+}
+
+// dithering returns the quantization of the gradients
+func (s *session) dithering() Dithering {
+	if s == nil {
+		return DitherNone
+	}
+	return s.dither
+}
+
+// targetColorSpace returns the color space of the output
+func (s *session) targetColorSpace() ColorSpace {
+	if s == nil {
+		return ColorSpaceSRGB
+	}
+	return s.colorSpace
+}
+
+// failed returns true if a previous operation aborted the rendering
+func (s *session) failed() bool { return s != nil && s.error() != nil }
+
+// error returns the first error recorded, if any
+func (s *session) error() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// fail records `err`, if no error has already been recorded
+func (s *session) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// checkContext returns false if the rendering should be aborted
+func (s *session) checkContext() bool {
+	if s == nil {
+		return true
+	}
+	if s.failed() {
+		return false
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.fail(fmt.Errorf("gosvg: rendering aborted: %w", err))
+		return false
+	}
+	return true
+}
+
+// glyphCache returns the cache shared by the renderings
+// using the same fonts, or nil
+func (s *session) glyphCache() *glyphCache {
+	if s == nil {
+		return nil
+	}
+	return s.glyphs
+}
+
+// recordsShapes returns true if the shapes are recorded
+// for a distance field instead of being rasterized
+func (s *session) recordsShapes() bool {
+	return s != nil && s.distanceField
+}
@@ -0,0 +1,152 @@
+package gosvg
+
+import (
+	"image"
+	"math"
+
+	"github.com/benoitkugler/webrender/matrix"
+	"github.com/benoitkugler/webrender/svg"
+)
+
+// cssPixelsPerInch is the resolution at which one CSS pixel
+// is one output pixel
+const cssPixelsPerInch = 96
+
+// defaultIntrinsicSize is used for the missing dimensions of
+// the images with no size and no viewBox, in CSS pixels
+const defaultIntrinsicSize = 600
+
+// rootFontSize is the font size used to resolve the em and ex units,
+// in CSS pixels, matching the default of the SVG parser
+const rootFontSize = 16
+
+// cssPixels returns the length in CSS pixels, or false for percentages,
+// which are not resolved.
+func (l Length) cssPixels() (Fl, bool) {
+	var perUnit float64
+	switch l.Unit {
+	case "", "px":
+		perUnit = 1
+	case "in":
+		perUnit = cssPixelsPerInch
+	case "cm":
+		perUnit = cssPixelsPerInch / 2.54
+	case "mm":
+		perUnit = cssPixelsPerInch / 25.4
+	case "q":
+		perUnit = cssPixelsPerInch / 101.6
+	case "pt":
+		perUnit = cssPixelsPerInch / 72.
+	case "pc":
+		perUnit = cssPixelsPerInch / 6.
+	case "em":
+		perUnit = rootFontSize
+	case "ex":
+		perUnit = rootFontSize / 2
+	default: // %
+		return 0, false
+	}
+	return Fl(l.Value * perUnit), true
+}
+
+// intrinsicSize returns the size of the image in CSS pixels, from the
+// width and height properties of the root element, the missing one following
+// the aspect ratio of the viewBox.
+// The size of the viewBox is used if none is given.
+func intrinsicSize(root map[string]string, viewBox *svg.Rectangle) (width, height Fl) {
+	var hasWidth, hasHeight bool
+	if l, ok := parseLength(root["width"]); ok {
+		width, hasWidth = l.cssPixels()
+	}
+	if l, ok := parseLength(root["height"]); ok {
+		height, hasHeight = l.cssPixels()
+	}
+	hasRatio := viewBox != nil && viewBox.Width > 0 && viewBox.Height > 0
+
+	switch {
+	case hasWidth && hasHeight:
+	case hasWidth && hasRatio:
+		height = width * viewBox.Height / viewBox.Width
+	case hasHeight && hasRatio:
+		width = height * viewBox.Width / viewBox.Height
+	case hasWidth:
+		height = defaultIntrinsicSize
+	case hasHeight:
+		width = defaultIntrinsicSize
+	case viewBox != nil:
+		width, height = viewBox.Width, viewBox.Height
+	default:
+		width, height = defaultIntrinsicSize, defaultIntrinsicSize
+	}
+	return width, height
+}
+
+// pixelSize rounds a dimension of the output to the nearest integer,
+// halves being rounded up, with at least one pixel for positive values.
+func pixelSize(v Fl) int {
+	if !(v > 0) {
+		return 0
+	}
+	if out := math.Floor(float64(v) + 0.5); out >= 1 {
+		return int(out)
+	}
+	return 1
+}
+
+// outputLayout is the size of the output, and how the image is mapped to it
+type outputLayout struct {
+	width, height int // in pixels
+	// scale maps the user units to pixels, for the images without viewBox
+	// (the viewBox is otherwise mapped by svg.SVGImage.Draw).
+	scale Fl
+}
+
+// outputLayout returns the size of the output, which is the intrinsic size of
+// the image at opts.DPI, unless overridden by opts.Width and opts.Height,
+// and multiplied by opts.Scale.
+// `width` and `height` are the unrounded size, in pixels.
+func (opts *Options) outputLayout(root map[string]string, icon *svg.SVGImage) (out outputLayout, width, height Fl) {
+	cssWidth, cssHeight := intrinsicSize(root, icon.ViewBox())
+	dpi := opts.DPI
+	if !(dpi > 0) {
+		dpi = cssPixelsPerInch
+	}
+	width, height = cssWidth*dpi/cssPixelsPerInch, cssHeight*dpi/cssPixelsPerInch
+
+	switch {
+	case opts.Width > 0 && opts.Height > 0:
+		width, height = Fl(opts.Width), Fl(opts.Height)
+	case opts.Width > 0 && width > 0:
+		width, height = Fl(opts.Width), height*Fl(opts.Width)/width
+	case opts.Height > 0 && height > 0:
+		width, height = width*Fl(opts.Height)/height, Fl(opts.Height)
+	}
+	if opts.Scale > 0 {
+		width, height = width*opts.Scale, height*opts.Scale
+	}
+
+	out.width, out.height = pixelSize(width), pixelSize(height)
+	out.scale = 1
+	if icon.ViewBox() == nil && cssWidth > 0 && cssHeight > 0 {
+		// keep the aspect ratio, as the viewBox would
+		out.scale = Fl(math.Min(float64(out.width)/float64(cssWidth), float64(out.height)/float64(cssHeight)))
+	}
+	return out, width, height
+}
+
+func (l outputLayout) rect() image.Rectangle { return image.Rect(0, 0, l.width, l.height) }
+
+// newCanvas returns the canvas drawing the whole image into `dst`,
+// which is the output or one of its tiles, and the size to give
+// to svg.SVGImage.Draw
+func (l outputLayout) newCanvas(dst *image.RGBA, sess *session) (cv *Canvas, width, height Fl) {
+	width, height = Fl(l.width), Fl(l.height)
+	if l.scale > 0 && l.scale != 1 {
+		width, height = width/l.scale, height/l.scale
+	}
+	cv = newCanvas(0, 0, width, height, dst, nil, sess)
+	if l.scale > 0 && l.scale != 1 {
+		cv.state.mat = matrix.Scaling(l.scale, l.scale)
+	}
+	return cv, width, height
+}
@@ -0,0 +1,101 @@
+package gosvg
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/benoitkugler/webrender/svg"
+)
+
+func TestIntrinsicSize(t *testing.T) {
+	viewBox := &svg.Rectangle{Width: 20, Height: 10}
+	for _, tt := range []struct {
+		width, height string
+		viewBox       *svg.Rectangle
+		expW, expH    Fl
+	}{
+		{"", "", nil, 600, 600},
+		{"", "", viewBox, 20, 10},
+		{"30", "40", viewBox, 30, 40},
+		{"1in", "72pt", nil, 96, 96},
+		{"2.54cm", "6pc", nil, 96, 96},
+		{"25.4mm", "101.6Q", nil, 96, 96},
+		{"2em", "4ex", nil, 32, 32},
+		{"40px", "", viewBox, 40, 20},
+		{"", "1in", viewBox, 192, 96},
+		{"100%", "100%", viewBox, 20, 10},
+		{"50%", "5", viewBox, 10, 5},
+		{"50", "", nil, 50, 600},
+		{"auto", "invalid", nil, 600, 600},
+	} {
+		root := map[string]string{"width": tt.width, "height": tt.height}
+		w, h := intrinsicSize(root, tt.viewBox)
+		if math.Abs(float64(w-tt.expW)) > 1e-4 || math.Abs(float64(h-tt.expH)) > 1e-4 {
+			t.Fatalf("%q x %q: expected %gx%g, got %gx%g", tt.width, tt.height, tt.expW, tt.expH, w, h)
+		}
+	}
+}
+
+func TestPixelSize(t *testing.T) {
+	for v, exp := range map[Fl]int{
+		0:      0,
+		-2:     0,
+		0.2:    1,
+		0.5:    1,
+		1.49:   1,
+		1.5:    2,
+		295.27: 295,
+		99.99:  100,
+	} {
+		if got := pixelSize(v); got != exp {
+			t.Fatalf("%g: expected %d, got %d", v, exp, got)
+		}
+	}
+}
+
+func TestPhysicalSize(t *testing.T) {
+	for _, tt := range []struct {
+		src  string
+		opts Options
+		exp  image.Point
+	}{
+		{`<svg width="25mm" height="2in" viewBox="0 0 10 10"></svg>`, Options{}, image.Pt(94, 192)},
+		{`<svg width="25mm" height="2in" viewBox="0 0 10 10"></svg>`, Options{DPI: 300}, image.Pt(295, 600)},
+		{`<svg width="24" viewBox="0 0 48 96"></svg>`, Options{}, image.Pt(24, 48)},
+		{`<svg width="10.5" height="10.4"></svg>`, Options{}, image.Pt(11, 10)},
+		{`<svg width="1in" height="1in"></svg>`, Options{DPI: 300, Width: 150}, image.Pt(150, 150)},
+		{`<svg width="1in" height="1in"></svg>`, Options{DPI: 150, Scale: 2}, image.Pt(300, 300)},
+	} {
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(tt.src), &tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := img.Bounds().Size(); got != tt.exp {
+			t.Fatalf("%s %+v: expected %v, got %v", tt.src, tt.opts, tt.exp, got)
+		}
+	}
+}
+
+func TestDPIWithoutViewBox(t *testing.T) {
+	// without viewBox, the user units are scaled to the output
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20">
+		<rect width="10" height="10" fill="black" />
+	</svg>`
+	for _, opts := range []Options{{DPI: 192}, {Width: 40}, {TileSize: 16, Rasterizer: RasterizerCell, DPI: 192}} {
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := img.Bounds().Size(); got != image.Pt(40, 40) {
+			t.Fatalf("%+v: unexpected size %v", opts, got)
+		}
+		black := color.RGBA{A: 0xff}
+		if img.At(19, 19) != black || img.At(21, 21) != (color.RGBA{}) {
+			t.Fatalf("%+v: unexpected pixels %v %v", opts, img.At(19, 19), img.At(21, 21))
+		}
+	}
+}
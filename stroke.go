@@ -0,0 +1,116 @@
+package gosvg
+
+import (
+	"strings"
+
+	"github.com/srwiley/rasterx"
+)
+
+// StrokeOptions exposes the stroking features of the rasterizer
+// which are not available through the properties supported by
+// the SVG parser. The zero value follows the SVG document.
+type StrokeOptions struct {
+	// MiterJoin, if not empty, overrides the stroke-linejoin property
+	// of the elements, for all the shapes with miter joins
+	// ("miter", "miter-clip" or "arcs").
+	// Supported values are the SVG2 joins "miter", "miter-clip" and "arcs",
+	// and "arcs-clip", which clips the arcs at the miter limit like "miter-clip".
+	MiterJoin string
+
+	// StartCap and EndCap, if not CapAuto, override
+	// the stroke-linecap property at the start and
+	// the end of the open sub-paths (and of the dashes).
+	StartCap, EndCap Cap
+
+	// Gap is the shape used to fill the convex side of the joins
+	// where no miter nor arc is drawn (that is, the part of the
+	// "miter-clip" and "arcs-clip" joins beyond the miter limit).
+	// It defaults to GapRound.
+	Gap Gap
+}
+
+// Cap is the shape of the end of a stroked open sub-path.
+type Cap uint8
+
+const (
+	// CapAuto uses the stroke-linecap property.
+	CapAuto Cap = iota
+	CapButt
+	CapRound
+	CapSquare
+	// CapCubic and CapQuadratic end the stroke with a
+	// smooth point, extending it like CapRound.
+	CapCubic
+	CapQuadratic
+)
+
+// Gap is the shape used to bridge the gaps of the joins.
+type Gap uint8
+
+const (
+	GapRound Gap = iota
+	GapFlat
+	GapCubic
+	GapQuadratic
+)
+
+var (
+	capFuncs = [...]rasterx.CapFunc{
+		CapButt:      rasterx.ButtCap,
+		CapRound:     rasterx.RoundCap,
+		CapSquare:    rasterx.SquareCap,
+		CapCubic:     rasterx.CubicCap,
+		CapQuadratic: rasterx.QuadraticCap,
+	}
+
+	gapFuncs = [...]rasterx.GapFunc{
+		GapRound:     rasterx.RoundGap,
+		GapFlat:      rasterx.FlatGap,
+		GapCubic:     rasterx.CubicGap,
+		GapQuadratic: rasterx.QuadraticGap,
+	}
+)
+
+// strokeStyle is the resolved form of StrokeOptions
+type strokeStyle struct {
+	miterJoin    rasterx.JoinMode // used instead of the miter joins, if overrideJoin is true
+	overrideJoin bool
+	capL, capT   rasterx.CapFunc // leading (end) and trailing (start) caps, nil to use the backend cap
+	gap          rasterx.GapFunc
+}
+
+var defaultStrokeStyle = strokeStyle{miterJoin: rasterx.Miter, gap: rasterx.RoundGap}
+
+// strokeStyle resolves opts.Stroke
+func (opts *Options) strokeStyle() strokeStyle {
+	out := defaultStrokeStyle
+	if join := opts.Stroke.MiterJoin; join != "" {
+		out.miterJoin = miterJoin(join)
+		out.overrideJoin = true
+	}
+	if c := opts.Stroke.EndCap; c != CapAuto && int(c) < len(capFuncs) {
+		out.capL = capFuncs[c]
+	}
+	if c := opts.Stroke.StartCap; c != CapAuto && int(c) < len(capFuncs) {
+		out.capT = capFuncs[c]
+	}
+	if g := opts.Stroke.Gap; int(g) < len(gapFuncs) {
+		out.gap = gapFuncs[g]
+	}
+	return out
+}
+
+// miterJoin returns the join used for a value of StrokeOptions.MiterJoin,
+// defaulting to rasterx.Miter
+func miterJoin(value string) rasterx.JoinMode {
+	switch strings.TrimSpace(value) {
+	case "miter-clip":
+		return rasterx.MiterClip
+	case "arcs":
+		return rasterx.Arc
+	case "arcs-clip":
+		return rasterx.ArcClip
+	default:
+		return rasterx.Miter
+	}
+}
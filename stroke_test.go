@@ -0,0 +1,125 @@
+package gosvg
+
+import (
+	"context"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/benoitkugler/webrender/backend"
+	"github.com/srwiley/rasterx"
+)
+
+func TestMiterJoin(t *testing.T) {
+	for _, tt := range []struct {
+		opts     StrokeOptions
+		exp      rasterx.JoinMode
+		override bool
+	}{
+		{StrokeOptions{}, rasterx.Miter, false},
+		{StrokeOptions{MiterJoin: "miter-clip"}, rasterx.MiterClip, true},
+		{StrokeOptions{MiterJoin: "arcs"}, rasterx.Arc, true},
+		{StrokeOptions{MiterJoin: "arcs-clip"}, rasterx.ArcClip, true},
+		{StrokeOptions{MiterJoin: "miter"}, rasterx.Miter, true},
+	} {
+		opts := Options{Stroke: tt.opts}
+		got := opts.strokeStyle()
+		if got.miterJoin != tt.exp || got.overrideJoin != tt.override {
+			t.Fatalf("%v: expected join %d (%v), got %d (%v)", tt.opts, tt.exp, tt.override, got.miterJoin, got.overrideJoin)
+		}
+	}
+}
+
+// strokeWith strokes `path` in a 120x100 image, with a width of 10,
+// and returns the alpha of the pixel (x, y)
+func strokeWith(stroke StrokeOptions, opts backend.StrokeOptions, path [][2]Fl, x, y int) uint8 {
+	img := image.NewRGBA(image.Rect(0, 0, 120, 100))
+	sess := newSession(context.Background(), Limits{})
+	sess.stroke = (&Options{Stroke: stroke}).strokeStyle()
+	output := newCanvas(0, 0, 120, 100, img, nil, sess)
+	output.State().SetStrokeOptions(opts)
+	output.State().SetLineWidth(10)
+	output.MoveTo(path[0][0], path[0][1])
+	for _, p := range path[1:] {
+		output.LineTo(p[0], p[1])
+	}
+	output.Paint(backend.Stroke)
+	return img.RGBAAt(x, y).A
+}
+
+func TestStrokeJoins(t *testing.T) {
+	// a sharp angle, whose miter exceeds the limit
+	path := [][2]Fl{{10, 40}, {80, 45}, {10, 50}}
+	opts := backend.StrokeOptions{LineJoin: backend.Miter, MiterLimit: 4}
+	if a := strokeWith(StrokeOptions{}, opts, path, 90, 45); a != 0 {
+		t.Fatalf("miter join beyond the limit should be beveled, got alpha %d", a)
+	}
+	if a := strokeWith(StrokeOptions{MiterJoin: "miter-clip"}, opts, path, 90, 45); a != 0xff {
+		t.Fatalf("miter-clip join should extend to the limit, got alpha %d", a)
+	}
+	opts.LineJoin = backend.MiterClip
+	if a := strokeWith(StrokeOptions{}, opts, path, 90, 45); a != 0xff {
+		t.Fatalf("miter-clip join should extend to the limit, got alpha %d", a)
+	}
+	if a := strokeWith(StrokeOptions{MiterJoin: "miter"}, opts, path, 90, 45); a != 0 {
+		t.Fatalf("miter-clip join should be replaced, got alpha %d", a)
+	}
+	// the other joins are not replaced
+	opts.LineJoin = backend.Bevel
+	if a := strokeWith(StrokeOptions{MiterJoin: "miter-clip"}, opts, path, 90, 45); a != 0 {
+		t.Fatalf("bevel join should not be replaced, got alpha %d", a)
+	}
+}
+
+func TestStrokeJoinElements(t *testing.T) {
+	// the same sharp angle, with a miter-clip join set on
+	// the shape, inherited from a group, set by a style sheet, and not set
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="120" height="400">
+	<style>.clip { stroke-linejoin: miter-clip }</style>
+	<path d="M10 40 L80 45 L10 50" stroke-linejoin="miter-clip" stroke="black" stroke-width="10" stroke-miterlimit="4" fill="none"/>
+	<g stroke-linejoin="miter-clip">
+		<path d="M10 140 L80 145 L10 150" stroke="black" stroke-width="10" stroke-miterlimit="4" fill="none"/>
+	</g>
+	<path class="clip" d="M10 240 L80 245 L10 250" stroke="black" stroke-width="10" stroke-miterlimit="4" fill="none"/>
+	<path d="M10 340 L80 345 L10 350" stroke="black" stroke-width="10" stroke-miterlimit="4" fill="none"/>
+	</svg>`
+	for _, tt := range []struct {
+		stroke StrokeOptions
+		exp    [4]uint8
+	}{
+		{StrokeOptions{}, [4]uint8{0xff, 0xff, 0xff, 0}},
+		{StrokeOptions{MiterJoin: "miter"}, [4]uint8{0, 0, 0, 0}},
+		{StrokeOptions{MiterJoin: "miter-clip"}, [4]uint8{0xff, 0xff, 0xff, 0xff}},
+	} {
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &Options{Stroke: tt.stroke})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rgba := img.(*image.RGBA)
+		for i, exp := range tt.exp {
+			if a := rgba.RGBAAt(90, 45+100*i).A; a != exp {
+				t.Fatalf("%v: shape %d: expected alpha %d, got %d", tt.stroke, i, exp, a)
+			}
+		}
+	}
+}
+
+func TestStrokeCaps(t *testing.T) {
+	path := [][2]Fl{{20, 50}, {80, 50}}
+	opts := backend.StrokeOptions{LineCap: backend.ButtCap}
+	for _, tt := range []struct {
+		stroke     StrokeOptions
+		start, end uint8 // alpha before the start and after the end
+	}{
+		{StrokeOptions{}, 0, 0},
+		{StrokeOptions{StartCap: CapSquare}, 0xff, 0},
+		{StrokeOptions{EndCap: CapRound}, 0, 0xff},
+		{StrokeOptions{StartCap: CapRound, EndCap: CapSquare}, 0xff, 0xff},
+	} {
+		start := strokeWith(tt.stroke, opts, path, 17, 50)
+		end := strokeWith(tt.stroke, opts, path, 82, 50)
+		if start != tt.start || end != tt.end {
+			t.Fatalf("%v: expected alphas %d, %d, got %d, %d", tt.stroke, tt.start, tt.end, start, end)
+		}
+	}
+}
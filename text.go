@@ -0,0 +1,248 @@
+package gosvg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/benoitkugler/textlayout/fonts"
+	"github.com/benoitkugler/textlayout/fonts/truetype"
+	"github.com/benoitkugler/textlayout/pango"
+	"github.com/benoitkugler/webrender/backend"
+	"github.com/benoitkugler/webrender/css/parser"
+	"github.com/benoitkugler/webrender/matrix"
+)
+
+// textFont is a font registered by AddFont
+type textFont struct {
+	meta *backend.Font // filled by the SVG parser
+	face fonts.Face
+	upem Fl
+
+	// shared by the renderings, may be nil
+	glyphs *glyphCache
+	key    faceKey
+
+	// color glyphs, empty if the font has none
+	colr    colrTable
+	palette []parser.RGBA
+}
+
+// newTextFont loads the color tables of `font`, whose file
+// is `content` (which may be nil, disabling them).
+func newTextFont(font pango.Font, content []byte, sess *session) *textFont {
+	out := &textFont{
+		meta: &backend.Font{Cmap: make(map[fonts.GID][]rune), Extents: make(map[fonts.GID]backend.GlyphExtents)},
+		face: font.GetHarfbuzzFont().Face(),
+	}
+	out.glyphs, out.key = sess.glyphCache(), newFaceKey(font.FaceID(), out.face)
+	out.upem = Fl(out.face.Upem())
+	if out.upem == 0 {
+		out.upem = 1000
+	}
+	if len(content) == 0 {
+		return out
+	}
+
+	parsers, err := truetype.NewFontParsers(bytes.NewReader(content))
+	index := int(font.FaceID().Index)
+	if err != nil || index >= len(parsers) {
+		return out // not an OpenType font
+	}
+	pr := parsers[index]
+	if !pr.HasTable(truetype.MustNewTag("COLR")) {
+		return out
+	}
+	colr, err := pr.GetRawTable(truetype.MustNewTag("COLR"))
+	if err == nil {
+		out.colr, err = parseCOLR(colr)
+	}
+	if err == nil {
+		var cpal []byte
+		if cpal, err = pr.GetRawTable(truetype.MustNewTag("CPAL")); err == nil {
+			out.palette, err = parseCPAL(cpal)
+		}
+	}
+	if err != nil {
+		out.colr = colrTable{}
+		sess.warn(Warning{Feature: "font", Message: fmt.Sprintf("color glyphs of %s: %s", font.FaceID().File, err)})
+	}
+	return out
+}
+
+// textFont returns the data of `font`, loading it on first use.
+func (s *session) textFont(font pango.Font, content []byte) *textFont {
+	if s == nil {
+		return newTextFont(font, content, nil)
+	}
+	s.mu.Lock()
+	out := s.fonts[font]
+	s.mu.Unlock()
+	if out != nil {
+		return out
+	}
+
+	out = newTextFont(font, content, s)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if other := s.fonts[font]; other != nil { // loaded concurrently
+		return other
+	}
+	if s.fonts == nil {
+		s.fonts = make(map[pango.Font]*textFont)
+	}
+	s.fonts[font] = out
+	return out
+}
+
+// AddFont register a new font to be used in the output and return
+// an object used to store associated metadata.
+// This method will be called several times with the same `font` argument,
+// so caching is advised.
+func (cv *Canvas) AddFont(font pango.Font, content []byte) *backend.Font {
+	return cv.session.textFont(font, content).meta
+}
+
+// DrawText draws the given text using the current fill color.
+// The rendering may be altered by a preivous `SetTextPaint` call.
+// The fonts of the runs have been registred with `AddFont`.
+//
+// The layers of the COLR glyphs are filled with the colors of the first
+// CPAL palette, and the bitmap glyphs (sbix and CBDT tables, in PNG or JPEG)
+// are scaled to their extents. Both use the opacity of the fill color.
+//
+// The text is ignored, with a warning, when no fonts are configured.
+func (cv *Canvas) DrawText(texts []backend.TextDrawing) {
+	if cv.session != nil && cv.session.withoutFonts {
+		cv.state.warn(Warning{Feature: "text", Message: "text is ignored since no fonts are configured"})
+		return
+	}
+	for _, text := range texts {
+		// origin at the baseline
+		textMat := cv.state.mat
+		textMat.RightMultBy(matrix.Translation(text.X, text.Y))
+		if text.Angle != 0 {
+			textMat.RightMultBy(matrix.Rotation(text.Angle))
+		}
+		ppem := devicePpem(textMat, text.FontSize)
+		for _, run := range text.Runs {
+			font := cv.session.textFont(run.Font, nil)
+			scale := text.FontSize / font.upem
+			for _, glyph := range run.Glyphs {
+				if !cv.session.checkContext() {
+					return
+				}
+				if glyph.Glyph == fonts.EmptyGlyph {
+					continue
+				}
+				// the offset, used to position the marks,
+				// is in Pango units normalized by the font size
+				x := (glyph.XAdvance/1000 + glyph.Offset/pango.Scale) * text.FontSize
+				// font units, with the y axis going up
+				mat := textMat
+				mat.RightMultBy(matrix.Translation(x, 0))
+				mat.RightMultBy(matrix.Scaling(scale, -scale))
+				cv.drawGlyph(font, glyph.Glyph, mat, ppem)
+			}
+		}
+	}
+}
+
+// devicePpem returns the number of pixels per em of a text
+// drawn with `mat`, used to select the bitmap glyphs
+func devicePpem(mat matrix.Transform, fontSize Fl) uint16 {
+	ppem := math.Sqrt(math.Abs(float64(mat.Determinant()))) * float64(fontSize)
+	return uint16(math.Max(1, math.Min(math.Round(ppem), math.MaxUint16)))
+}
+
+// drawGlyph draws `glyph`, whose coordinates are mapped to the output by `mat`
+func (cv *Canvas) drawGlyph(font *textFont, glyph fonts.GID, mat matrix.Transform, ppem uint16) {
+	saved := cv.state.mat
+	cv.state.mat = mat
+	defer func() { cv.state.mat = saved }()
+
+	if layers := font.colr.glyphLayers(glyph); len(layers) != 0 {
+		cv.drawColorGlyph(font, layers)
+		return
+	}
+
+	outline := font.outline(glyph, ppem)
+	switch {
+	case outline.bitmap:
+		if data, ok := font.face.GlyphData(glyph, ppem, ppem).(fonts.GlyphBitmap); ok {
+			cv.drawBitmapGlyph(font, glyph, data, ppem)
+		}
+	case outline.fromSVG:
+		cv.state.warn(Warning{Feature: "font", Message: "SVG glyphs are drawn with their fallback outline"})
+		fallthrough
+	default:
+		cv.fillGlyph(font, glyph, outline)
+	}
+}
+
+// fillGlyph paints `outline`, with the current text paint
+func (cv *Canvas) fillGlyph(font *textFont, glyph fonts.GID, outline glyphOutline) {
+	op := cv.state.textPaint
+	isFill := op&backend.Stroke == 0 && op&(backend.FillNonZero|backend.FillEvenOdd) != 0
+	if isFill && cv.fillGlyphCoverage(font, glyph, outline, cv.state.mat, op) {
+		return
+	}
+	for _, seg := range outline.path {
+		if seg.op == closeOp {
+			cv.ClosePath()
+		} else {
+			cv.addSegment(seg)
+		}
+	}
+	cv.Paint(op)
+}
+
+// drawColorGlyph fills the outlines of `layers` with their palette color
+func (cv *Canvas) drawColorGlyph(font *textFont, layers []colrLayer) {
+	foreground := cv.state.fillColor
+	defer func() { cv.state.fillColor = foreground }()
+	opacity := cv.state.fillOpacity()
+	for _, layer := range layers {
+		cv.state.fillColor = foreground
+		if layer.paletteIndex != foregroundPaletteIndex && int(layer.paletteIndex) < len(font.palette) {
+			c := font.palette[layer.paletteIndex]
+			c.A *= opacity
+			cv.state.fillColor = plainColor(cv.state.colorSpace.convert(c))
+		}
+		if outline := font.outline(layer.glyph, 0); !outline.bitmap {
+			cv.fillGlyph(font, layer.glyph, outline)
+		}
+	}
+}
+
+// drawBitmapGlyph draws the PNG or JPEG image of `glyph` in its extents
+func (cv *Canvas) drawBitmapGlyph(font *textFont, glyph fonts.GID, data fonts.GlyphBitmap, ppem uint16) {
+	if cv.state.textPaint&(backend.FillNonZero|backend.FillEvenOdd) == 0 {
+		return
+	}
+	if data.Format != fonts.PNG && data.Format != fonts.JPG {
+		cv.state.warn(Warning{Feature: "font", Message: "only PNG and JPEG bitmap glyphs are supported"})
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data.Data))
+	if err != nil {
+		cv.state.warn(Warning{Feature: "font", Message: fmt.Sprintf("invalid bitmap glyph: %s", err)})
+		return
+	}
+	if opacity := cv.state.fillOpacity(); opacity < 1 {
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Rect, img, rgba.Rect.Min, draw.Src)
+		applyOpacity(rgba, opacity)
+		img = rgba
+	}
+
+	extents, ok := font.face.GlyphExtents(glyph, ppem, ppem)
+	if !ok || extents.Width <= 0 || extents.Height >= 0 {
+		// use an em square on the baseline
+		extents = fonts.GlyphExtents{YBearing: float32(font.upem), Width: float32(font.upem), Height: -float32(font.upem)}
+	}
+	cv.state.mat.RightMultBy(matrix.Translation(Fl(extents.XBearing), Fl(extents.YBearing)))
+	cv.drawImage(img, Fl(extents.Width), Fl(extents.Height), "")
+}
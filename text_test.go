@@ -0,0 +1,177 @@
+package gosvg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benoitkugler/textlayout/fonts"
+	"github.com/benoitkugler/textlayout/fonts/truetype"
+	"github.com/benoitkugler/textlayout/harfbuzz"
+	"github.com/benoitkugler/textlayout/pango"
+	"github.com/benoitkugler/webrender/backend"
+	"github.com/benoitkugler/webrender/css/parser"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// testFont is a pango.Font backed by a file of testdata/fonts,
+// implementing only the methods used by DrawText
+type testFont struct {
+	pango.Font
+	hb *harfbuzz.Font
+	id fonts.FaceID
+}
+
+func (f *testFont) GetHarfbuzzFont() *harfbuzz.Font { return f.hb }
+
+func (f *testFont) FaceID() fonts.FaceID { return f.id }
+
+func loadTestFont(t *testing.T, name string) (*testFont, []byte) {
+	t.Helper()
+	path := "testdata/fonts/" + name
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face, err := truetype.Parse(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testFont{hb: harfbuzz.NewFont(face), id: fonts.FaceID{File: path}}, content
+}
+
+// drawTestGlyph draws `glyph` at (x, y), with a font size of 64
+func drawTestGlyph(font pango.Font, content []byte, glyph fonts.GID, x, y Fl, fill parser.RGBA) (*image.RGBA, []Warning) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	sess := newSession(context.Background(), Limits{})
+	cv := newCanvas(0, 0, 100, 100, img, nil, sess)
+	cv.AddFont(font, content)
+	cv.state.SetColorRgba(fill, false)
+	cv.DrawText([]backend.TextDrawing{{
+		FontSize: 64, X: x, Y: y,
+		Runs: []backend.TextRun{{Font: font, Glyphs: []backend.TextGlyph{{Glyph: glyph}}}},
+	}})
+	return img, sess.getWarnings()
+}
+
+func closeColor(c1, c2 color.RGBA) bool {
+	d := func(a, b uint8) bool { return a-b <= 2 || b-a <= 2 }
+	return d(c1.R, c2.R) && d(c1.G, c2.G) && d(c1.B, c2.B) && d(c1.A, c2.A)
+}
+
+func TestDrawTextOutline(t *testing.T) {
+	font, content := loadTestFont(t, "colr.ttf")
+	red := color.RGBA{R: 0xff, A: 0xff}
+	img, _ := drawTestGlyph(font, content, 2, 10, 70, parser.RGBA{R: 1, A: 1})
+	var painted int
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+		if c == red {
+			painted++
+		} else if c.G != 0 || c.B != 0 {
+			t.Fatalf("unexpected color %v", c)
+		}
+	}
+	if painted == 0 {
+		t.Fatal("glyph not painted")
+	}
+	// the glyph is above the baseline
+	if img.RGBAAt(50, 90).A != 0 {
+		t.Fatal("unexpected pixel below the baseline")
+	}
+}
+
+func TestDrawTextCOLR(t *testing.T) {
+	font, content := loadTestFont(t, "colr.ttf")
+	const glyph = 8 // three horizontal stripes
+	img, warnings := drawTestGlyph(font, content, glyph, 0, 60, parser.RGBA{A: 1})
+	if len(warnings) != 0 {
+		t.Fatal(warnings)
+	}
+
+	loaded := newTextFont(font, content, nil)
+	layers := loaded.colr.glyphLayers(glyph)
+	if len(layers) != 3 {
+		t.Fatalf("unexpected layers %v", layers)
+	}
+	// the topmost layer at each point
+	for i, p := range [...]image.Point{{50, 15}, {50, 35}, {50, 55}} {
+		c := loaded.palette[layers[i].paletteIndex]
+		exp := color.RGBA{uint8(c.R*c.A*0xff + 0.5), uint8(c.G*c.A*0xff + 0.5), uint8(c.B*c.A*0xff + 0.5), uint8(c.A*0xff + 0.5)}
+		if got := img.RGBAAt(p.X, p.Y); !closeColor(got, exp) {
+			t.Fatalf("layer %d: expected %v, got %v", i, exp, got)
+		}
+	}
+
+	// without the font file, only the outline is available
+	img, _ = drawTestGlyph(font, nil, glyph, 0, 60, parser.RGBA{A: 1})
+	if got := img.RGBAAt(50, 35); got != (color.RGBA{A: 0xff}) && got != (color.RGBA{}) {
+		t.Fatalf("unexpected color %v", got)
+	}
+}
+
+func TestDrawTextBitmap(t *testing.T) {
+	for _, tt := range []struct {
+		file  string
+		glyph fonts.GID
+	}{
+		{"sbix.ttf", 4},
+		{"cbdt.ttf", 1},
+	} {
+		font, content := loadTestFont(t, tt.file)
+		img, warnings := drawTestGlyph(font, content, tt.glyph, 0, 70, parser.RGBA{A: 1})
+		if len(warnings) != 0 {
+			t.Fatal(warnings)
+		}
+		center := img.RGBAAt(40, 45)
+		if center.A == 0 || (center.R == center.G && center.G == center.B) {
+			t.Fatalf("%s: expected a colored pixel, got %v", tt.file, center)
+		}
+		if img.RGBAAt(95, 5).A != 0 {
+			t.Fatalf("%s: unexpected pixel outside of the glyph", tt.file)
+		}
+
+		// the fill opacity applies to the bitmap
+		img, _ = drawTestGlyph(font, content, tt.glyph, 0, 70, parser.RGBA{A: 0.5})
+		if got := img.RGBAAt(40, 45).A; got > center.A/2+2 || got+2 < center.A/2 {
+			t.Fatalf("%s: expected alpha %d, got %d", tt.file, center.A/2, got)
+		}
+	}
+}
+
+func TestDrawTextMarkOffset(t *testing.T) {
+	goFonts, err := LoadFonts(FontConfig{FS: fstest.MapFS{"goregular.ttf": {Data: goregular.TTF}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// returns the rightmost column with ink
+	inkRight := func(content string) int {
+		src := `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="100">
+		<text x="10" y="80" font-size="80" font-family="Go">` + content + `</text></svg>`
+		img, err := RenderWithOptions(context.Background(), strings.NewReader(src), &Options{Fonts: goFonts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		right := -1
+		rgba := img.(*image.RGBA)
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 200; x++ {
+				if rgba.RGBAAt(x, y).A != 0 && x > right {
+					right = x
+				}
+			}
+		}
+		return right
+	}
+	// the combining acute accent, drawn with the .notdef box of the Go
+	// fonts, is given no advance and an offset moving it back over the base
+	base, marked := inkRight("e"), inkRight("e&#x301;")
+	if base == -1 || marked > base+8 {
+		t.Fatalf("the mark should be drawn over the base, ending at %d instead of %d", marked, base)
+	}
+}
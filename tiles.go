@@ -0,0 +1,68 @@
+package gosvg
+
+import (
+	"image"
+	"runtime"
+	"sync"
+
+	"github.com/benoitkugler/webrender/svg"
+)
+
+// tileRects splits `bounds` into tiles of at most `size` x `size` pixels,
+// in row-major order.
+func tileRects(bounds image.Rectangle, size int) []image.Rectangle {
+	var out []image.Rectangle
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += size {
+		for x := bounds.Min.X; x < bounds.Max.X; x += size {
+			out = append(out, image.Rect(x, y, x+size, y+size).Intersect(bounds))
+		}
+	}
+	return out
+}
+
+// renderTiles draws the image into `dst`, which is split into tiles
+// rendered concurrently by at most `workers` goroutines.
+// Each tile is a sub-image of `dst`, with its own scanners, so that
+// no stitching is required and the pixels are the same as
+// when drawing `dst` at once.
+// Since drawing a svg.SVGImage is not safe for concurrent use, only
+// the first tile uses `icon` and `texts`: the other ones build their
+// own copies from `doc` and `fonts`, which may be nil.
+// The errors are reported in `sess`.
+func renderTiles(doc *document, icon *svg.SVGImage, texts *textContext, dst *image.RGBA, layout outputLayout,
+	sess *session, fonts *Fonts, tileSize, workers int) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	tiles := tileRects(dst.Rect, tileSize)
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, r := range tiles {
+		if !sess.checkContext() {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, r image.Rectangle) {
+			defer func() { <-sem; wg.Done() }()
+
+			tileIcon, tileTexts := icon, texts
+			if i != 0 {
+				var err error
+				tileIcon, err = doc.icon()
+				if err == nil {
+					tileTexts, err = fonts.newTextContext()
+				}
+				if err != nil { // should not happen since the content and the fonts are already loaded
+					sess.fail(err)
+					return
+				}
+			}
+			tile := dst.SubImage(r).(*image.RGBA)
+			output, width, height := layout.newCanvas(tile, sess)
+			tileIcon.Draw(output, width, height, tileTexts)
+		}(i, r)
+	}
+	wg.Wait()
+}
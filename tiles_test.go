@@ -0,0 +1,77 @@
+package gosvg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestTileRects(t *testing.T) {
+	tiles := tileRects(image.Rect(0, 0, 250, 100), 100)
+	if len(tiles) != 3 {
+		t.Fatalf("expected 3 tiles, got %d", len(tiles))
+	}
+	if last := tiles[2]; last != image.Rect(200, 0, 250, 100) {
+		t.Fatalf("unexpected last tile %v", last)
+	}
+}
+
+func TestTilesIdentical(t *testing.T) {
+	for _, p := range []string{
+		"testdata/landscapeIcons/beach.svg",
+		"testdata/landscapeIcons/village.svg",
+		"testdata/testIcons/astronaut.svg",
+		"testdata/OpacityStrokeDashTest.svg",
+		"testdata/TestShapes4.svg",
+	} {
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, opts := range []Options{
+			{Rasterizer: RasterizerCell},
+			{Rasterizer: RasterizerCell, Antialiasing: AntialiasNone},
+			{Rasterizer: RasterizerCell, Antialiasing: AntialiasSupersample},
+		} {
+			img1, err := RenderWithOptions(context.Background(), bytes.NewReader(content), &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.TileSize, opts.TileWorkers = 100, 4
+			img2, err := RenderWithOptions(context.Background(), bytes.NewReader(content), &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, img1, img2)
+		}
+	}
+}
+
+func TestTilesRasterizer(t *testing.T) {
+	// RasterizerGV would produce seams
+	_, err := RenderWithOptions(context.Background(), strings.NewReader(template), &Options{TileSize: 100})
+	if err == nil {
+		t.Fatal("expected an error for tiles with RasterizerGV")
+	}
+}
+
+func TestTilesLimits(t *testing.T) {
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="200">
+	<rect width="150" height="150"/>
+	</svg>`
+	for _, tileSize := range []int{0, 50} {
+		// the segments are counted once, not for each tile
+		_, err := RenderWithOptions(context.Background(), strings.NewReader(src), &Options{TileSize: tileSize, Rasterizer: RasterizerCell, Limits: Limits{MaxPathSegments: 6}})
+		if err != nil {
+			t.Fatalf("tiles of %d: %s", tileSize, err)
+		}
+		_, err = RenderWithOptions(context.Background(), strings.NewReader(src), &Options{TileSize: tileSize, Rasterizer: RasterizerCell, Limits: Limits{MaxPathSegments: 2}})
+		if _, ok := err.(LimitError); !ok {
+			t.Fatalf("tiles of %d: expected a limit error, got %v", tileSize, err)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package gosvg
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/benoitkugler/textlayout/pango"
+	"github.com/benoitkugler/webrender/backend"
+	"github.com/benoitkugler/webrender/css/parser"
+	"github.com/benoitkugler/webrender/matrix"
+)
+
+// Trace records the operations of a rendering,
+// to diagnose wrong outputs.
+// Tiles are not used when tracing (see Options.TileSize).
+type Trace struct {
+	// Calls, if not nil, receives one line for each call
+	// to the methods of backend.Canvas and backend.GraphicState,
+	// with its arguments. Canvas are named c0 (the output), c1, etc...
+	Calls io.Writer
+
+	// LayersDir, if not empty, is an existing directory where
+	// each group, mask and pattern is written as a PNG file,
+	// when it is used. The files are listed in the "index.txt" file,
+	// with the name of the canvas and the pixels covered.
+	LayersDir string
+}
+
+// tracer implements Trace, wrapping the canvas
+// of one rendering.
+// Errors are reported as warnings.
+type tracer struct {
+	*Trace
+	sess *session
+
+	canvases int // number of canvas created
+	layers   int // number of layers written
+	index    io.WriteCloser
+	depth    int // of OnNewStack calls, used for indentation
+}
+
+func newTracer(trace *Trace, sess *session) *tracer {
+	tr := &tracer{Trace: trace, sess: sess}
+	if trace.LayersDir != "" {
+		f, err := os.Create(filepath.Join(trace.LayersDir, "index.txt"))
+		if err != nil {
+			tr.fail(err)
+		} else {
+			tr.index = f
+		}
+	}
+	return tr
+}
+
+func (tr *tracer) fail(err error) {
+	tr.sess.warn(Warning{Feature: "trace", Message: err.Error()})
+}
+
+// close must be called at the end of the rendering
+func (tr *tracer) close() {
+	if tr.index != nil {
+		if err := tr.index.Close(); err != nil {
+			tr.fail(err)
+		}
+	}
+}
+
+// wrap returns a traced version of `cv`
+func (tr *tracer) wrap(cv backend.Canvas) *tracedCanvas {
+	out := &tracedCanvas{tr: tr, cv: cv, name: fmt.Sprintf("c%d", tr.canvases)}
+	tr.canvases++
+	return out
+}
+
+// call records the call of `method` on the canvas `name`
+func (tr *tracer) call(name, method string, args ...interface{}) {
+	if tr.Calls == nil {
+		return
+	}
+	formatted := make([]string, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case *tracedCanvas:
+			formatted[i] = arg.name
+		case string:
+			formatted[i] = fmt.Sprintf("%q", arg)
+		case backend.PaintOp:
+			formatted[i] = paintOpString(arg)
+		default:
+			formatted[i] = fmt.Sprintf("%v", arg)
+		}
+	}
+	line := fmt.Sprintf("%s%s.%s(%s)\n", strings.Repeat("\t", tr.depth), name, method, strings.Join(formatted, ", "))
+	if _, err := io.WriteString(tr.Calls, line); err != nil {
+		tr.fail(err)
+		tr.Calls = nil
+	}
+}
+
+func paintOpString(op backend.PaintOp) string {
+	var names []string
+	for _, flag := range [...]struct {
+		op   backend.PaintOp
+		name string
+	}{{backend.Stroke, "Stroke"}, {backend.FillEvenOdd, "FillEvenOdd"}, {backend.FillNonZero, "FillNonZero"}} {
+		if op&flag.op != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return strings.Join(names, "|")
+}
+
+// dumpLayer writes the content of the canvas `layer`, used as `kind`
+func (tr *tracer) dumpLayer(layer *tracedCanvas, kind string) {
+	if tr.index == nil {
+		return
+	}
+	img := layer.cv.(*Canvas).state.image
+	if img == nil || img.Rect.Empty() {
+		return
+	}
+	file := fmt.Sprintf("%03d-%s.png", tr.layers, kind)
+	tr.layers++
+	if err := tr.writePNG(file, img); err != nil {
+		tr.fail(err)
+		return
+	}
+	if _, err := fmt.Fprintf(tr.index, "%s\t%s\t%s\t%v\n", file, kind, layer.name, img.Rect); err != nil {
+		tr.fail(err)
+	}
+}
+
+func (tr *tracer) writePNG(file string, img *image.RGBA) error {
+	f, err := os.Create(filepath.Join(tr.LayersDir, file))
+	if err != nil {
+		return err
+	}
+	if err := EncodePNG(f, img, tr.sess.targetColorSpace()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// unwrap returns the canvas traced by `cv`
+func unwrap(cv backend.Canvas) backend.Canvas {
+	if tc, ok := cv.(*tracedCanvas); ok {
+		return tc.cv
+	}
+	return cv
+}
+
+// tracedCanvas records the calls to `cv`
+type tracedCanvas struct {
+	tr   *tracer
+	cv   backend.Canvas
+	name string
+}
+
+func (tc *tracedCanvas) GetRectangle() (left, top, right, bottom Fl) {
+	tc.tr.call(tc.name, "GetRectangle")
+	return tc.cv.GetRectangle()
+}
+
+func (tc *tracedCanvas) OnNewStack(f func()) {
+	tc.tr.call(tc.name, "OnNewStack")
+	tc.tr.depth++
+	tc.cv.OnNewStack(f)
+	tc.tr.depth--
+}
+
+func (tc *tracedCanvas) NewGroup(x, y, width, height Fl) backend.Canvas {
+	out := tc.tr.wrap(tc.cv.NewGroup(x, y, width, height))
+	tc.tr.call(tc.name, "NewGroup", x, y, width, height)
+	tc.tr.call(out.name, "created")
+	return out
+}
+
+func (tc *tracedCanvas) DrawWithOpacity(opacity Fl, group backend.Canvas) {
+	tc.tr.call(tc.name, "DrawWithOpacity", opacity, group)
+	if gr, ok := group.(*tracedCanvas); ok {
+		tc.tr.dumpLayer(gr, "group")
+	}
+	tc.cv.DrawWithOpacity(opacity, unwrap(group))
+}
+
+func (tc *tracedCanvas) State() backend.GraphicState {
+	return tracedState{tc: tc, st: tc.cv.State()}
+}
+
+func (tc *tracedCanvas) Paint(op backend.PaintOp) {
+	tc.tr.call(tc.name, "Paint", op)
+	tc.cv.Paint(op)
+}
+
+func (tc *tracedCanvas) Rectangle(x, y, width, height Fl) {
+	tc.tr.call(tc.name, "Rectangle", x, y, width, height)
+	tc.cv.Rectangle(x, y, width, height)
+}
+
+func (tc *tracedCanvas) MoveTo(x, y Fl) {
+	tc.tr.call(tc.name, "MoveTo", x, y)
+	tc.cv.MoveTo(x, y)
+}
+
+func (tc *tracedCanvas) LineTo(x, y Fl) {
+	tc.tr.call(tc.name, "LineTo", x, y)
+	tc.cv.LineTo(x, y)
+}
+
+func (tc *tracedCanvas) CubicTo(x1, y1, x2, y2, x3, y3 Fl) {
+	tc.tr.call(tc.name, "CubicTo", x1, y1, x2, y2, x3, y3)
+	tc.cv.CubicTo(x1, y1, x2, y2, x3, y3)
+}
+
+func (tc *tracedCanvas) ClosePath() {
+	tc.tr.call(tc.name, "ClosePath")
+	tc.cv.ClosePath()
+}
+
+func (tc *tracedCanvas) AddFont(font pango.Font, content []byte) *backend.Font {
+	tc.tr.call(tc.name, "AddFont", font)
+	return tc.cv.AddFont(font, content)
+}
+
+func (tc *tracedCanvas) DrawText(texts []backend.TextDrawing) {
+	tc.tr.call(tc.name, "DrawText", len(texts))
+	tc.cv.DrawText(texts)
+}
+
+func (tc *tracedCanvas) DrawRasterImage(img backend.RasterImage, width, height Fl) {
+	tc.tr.call(tc.name, "DrawRasterImage", img.MimeType, img.Rendering, width, height)
+	tc.cv.DrawRasterImage(img, width, height)
+}
+
+func (tc *tracedCanvas) DrawGradient(gradient backend.GradientLayout, width, height Fl) {
+	tc.tr.call(tc.name, "DrawGradient", gradient, width, height)
+	tc.cv.DrawGradient(gradient, width, height)
+}
+
+// tracedState records the calls to `st`
+type tracedState struct {
+	tc *tracedCanvas
+	st backend.GraphicState
+}
+
+func (ts tracedState) call(method string, args ...interface{}) {
+	ts.tc.tr.call(ts.tc.name, method, args...)
+}
+
+func (ts tracedState) SetAlphaMask(mask backend.Canvas) {
+	ts.call("SetAlphaMask", mask)
+	if m, ok := mask.(*tracedCanvas); ok {
+		ts.tc.tr.dumpLayer(m, "mask")
+	}
+	ts.st.SetAlphaMask(unwrap(mask))
+}
+
+func (ts tracedState) Clip(evenOdd bool) {
+	ts.call("Clip", evenOdd)
+	ts.st.Clip(evenOdd)
+}
+
+func (ts tracedState) SetColorRgba(color parser.RGBA, stroke bool) {
+	ts.call("SetColorRgba", color, stroke)
+	ts.st.SetColorRgba(color, stroke)
+}
+
+func (ts tracedState) SetColorPattern(pattern backend.Canvas, contentWidth, contentHeight Fl, mat matrix.Transform, stroke bool) {
+	ts.call("SetColorPattern", pattern, contentWidth, contentHeight, mat, stroke)
+	if p, ok := pattern.(*tracedCanvas); ok {
+		ts.tc.tr.dumpLayer(p, "pattern")
+	}
+	ts.st.SetColorPattern(unwrap(pattern), contentWidth, contentHeight, mat, stroke)
+}
+
+func (ts tracedState) SetBlendingMode(mode string) {
+	ts.call("SetBlendingMode", mode)
+	ts.st.SetBlendingMode(mode)
+}
+
+func (ts tracedState) SetLineWidth(width Fl) {
+	ts.call("SetLineWidth", width)
+	ts.st.SetLineWidth(width)
+}
+
+func (ts tracedState) SetDash(dashes []Fl, offset Fl) {
+	ts.call("SetDash", dashes, offset)
+	ts.st.SetDash(dashes, offset)
+}
+
+func (ts tracedState) SetStrokeOptions(opts backend.StrokeOptions) {
+	ts.call("SetStrokeOptions", opts)
+	ts.st.SetStrokeOptions(opts)
+}
+
+func (ts tracedState) GetTransform() matrix.Transform {
+	ts.call("GetTransform")
+	return ts.st.GetTransform()
+}
+
+func (ts tracedState) Transform(mt matrix.Transform) {
+	ts.call("Transform", mt)
+	ts.st.Transform(mt)
+}
+
+func (ts tracedState) SetTextPaint(op backend.PaintOp) {
+	ts.call("SetTextPaint", op)
+	ts.st.SetTextPaint(op)
+}
+
+func (ts tracedState) SetElementID(id string) {
+	ts.call("SetElementID", id)
+	ts.st.SetElementID(id)
+}
+
+func (ts tracedState) SetShapeRendering(value string) {
+	ts.call("SetShapeRendering", value)
+	ts.st.SetShapeRendering(value)
+}
+
+func (ts tracedState) SetIsolation(isolated bool) {
+	ts.call("SetIsolation", isolated)
+	ts.st.SetIsolation(isolated)
+}
+
+func (ts tracedState) SetVectorEffect(effect string) {
+	ts.call("SetVectorEffect", effect)
+	ts.st.SetVectorEffect(effect)
+}
+
+func (ts tracedState) SetPaintOrder(order string) {
+	ts.call("SetPaintOrder", order)
+	ts.st.SetPaintOrder(order)
+}
+
+var (
+	_ backend.Canvas       = (*tracedCanvas)(nil)
+	_ backend.GraphicState = tracedState{}
+)
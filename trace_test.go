@@ -0,0 +1,86 @@
+package gosvg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const tracedSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 20">
+	<mask id="m"><rect width="10" height="20" fill="white"/></mask>
+	<g opacity="0.5"><rect width="20" height="10" fill="red"/></g>
+	<rect y="10" width="20" height="10" fill="blue" mask="url(#m)"/>
+</svg>`
+
+func TestTrace(t *testing.T) {
+	var calls bytes.Buffer
+	dir := t.TempDir()
+	opts := &Options{Trace: &Trace{Calls: &calls, LayersDir: dir}, TileSize: 8, Rasterizer: RasterizerCell}
+	img, warnings, err := RenderWithWarnings(context.Background(), strings.NewReader(tracedSVG), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+
+	// tracing does not change the output
+	ref, err := RenderWithOptions(context.Background(), strings.NewReader(tracedSVG), &Options{Rasterizer: RasterizerCell})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.(*image.RGBA).Pix, ref.(*image.RGBA).Pix) {
+		t.Fatal("tracing changed the output")
+	}
+
+	for _, line := range []string{
+		"\t\tc0.NewGroup(0, 0, 20, 20)\n",
+		"\t\t\tc1.SetColorRgba({1 0 0 1}, false)\n",
+		"\t\t\tc1.Paint(FillNonZero)\n",
+		"\t\tc0.DrawWithOpacity(0.5, c1)\n",
+		"\t\tc0.SetAlphaMask(c2)\n",
+	} {
+		if !strings.Contains(calls.String(), line) {
+			t.Fatalf("missing call %q in\n%s", line, calls.String())
+		}
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the layers only cover the pixels drawn
+	exp := "000-group.png\tgroup\tc1\t(0,0)-(20,10)\n001-mask.png\tmask\tc2\t(0,0)-(10,20)\n"
+	if string(index) != exp {
+		t.Fatalf("unexpected index %q", index)
+	}
+	f, err := os.Open(filepath.Join(dir, "000-group.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	group, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, a := group.At(5, 5).RGBA(); r != 0xffff || a != 0xffff {
+		t.Fatalf("unexpected group content %v", group.At(5, 5))
+	}
+}
+
+func TestTraceInvalidDir(t *testing.T) {
+	opts := &Options{Trace: &Trace{LayersDir: filepath.Join(t.TempDir(), "missing")}}
+	_, warnings, err := RenderWithWarnings(context.Background(), strings.NewReader(tracedSVG), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].Feature != "trace" {
+		t.Fatalf("expected a trace warning, got %v", warnings)
+	}
+}
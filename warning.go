@@ -0,0 +1,81 @@
+package gosvg
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Warning reports a feature of the image which is not
+// supported, and has been ignored.
+// In strict mode (see Options.Strict), warnings are returned as errors.
+type Warning struct {
+	Feature string // the feature concerned, like "blend-mode"
+	ID      string // the id of the element concerned, if known
+	Message string
+}
+
+func (w Warning) Error() string {
+	if w.ID != "" {
+		return fmt.Sprintf("gosvg: %s (element %q): %s", w.Feature, w.ID, w.Message)
+	}
+	return fmt.Sprintf("gosvg: %s: %s", w.Feature, w.Message)
+}
+
+// warn records `w`, or aborts the rendering in strict mode.
+// Since tiles render the whole image, identical warnings are only recorded once.
+func (s *session) warn(w Warning) {
+	if s == nil {
+		return
+	}
+	if s.strict {
+		s.fail(w)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.warnings {
+		if other == w {
+			return
+		}
+	}
+	s.warnings = append(s.warnings, w)
+}
+
+// getWarnings returns the warnings recorded so far
+func (s *session) getWarnings() []Warning {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Warning(nil), s.warnings...)
+}
+
+// unsupportedElements are the elements ignored by the SVG parser
+var unsupportedElements = map[string]string{
+	"foreignObject": "foreign content is not supported",
+	"hatch":         "hatches are not supported",
+}
+
+// supportedFilters are the filter primitives supported by the SVG parser
+var supportedFilters = map[string]bool{"feOffset": true, "feBlend": true}
+
+// documentWarnings returns the warnings for the elements
+// of `doc` which are known to be ignored.
+func documentWarnings(doc *document) []Warning {
+	var (
+		out      []Warning
+		filterID string // of the enclosing <filter>
+	)
+	walk(doc.root, func(elem *html.Node, _ int) bool {
+		id, tag := attribute(elem, "id"), elem.Data
+		if message, ok := unsupportedElements[tag]; ok {
+			out = append(out, Warning{Feature: tag, ID: id, Message: message})
+		} else if tag == "filter" {
+			filterID = id
+		} else if strings.HasPrefix(tag, "fe") && !supportedFilters[tag] {
+			out = append(out, Warning{Feature: "filter", ID: filterID, Message: fmt.Sprintf("filter primitive <%s> is ignored", tag)})
+		}
+		return true
+	})
+	return out
+}
@@ -0,0 +1,106 @@
+package gosvg
+
+import (
+	"context"
+	"errors"
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const unsupportedSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10">
+	<filter id="shadow">
+		<feGaussianBlur stdDeviation="2"/>
+		<feOffset dx="1" dy="1"/>
+	</filter>
+	<foreignObject id="note" width="10" height="10"><p>Note</p></foreignObject>
+	<rect width="5" height="5" filter="url(#shadow)"/>
+</svg>`
+
+func TestDocumentWarnings(t *testing.T) {
+	doc, err := parseDocument(strings.NewReader(unsupportedSVG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := documentWarnings(doc)
+	exp := []Warning{
+		{Feature: "filter", ID: "shadow", Message: "filter primitive <feGaussianBlur> is ignored"},
+		{Feature: "foreignObject", ID: "note", Message: "foreign content is not supported"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestRenderWarnings(t *testing.T) {
+	img, warnings, err := RenderWithWarnings(context.Background(), strings.NewReader(unsupportedSVG), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img == nil || len(warnings) != 2 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+
+	_, _, err = RenderWithWarnings(context.Background(), strings.NewReader(unsupportedSVG), &Options{Strict: true})
+	var w Warning
+	if !errors.As(err, &w) || w.ID != "shadow" {
+		t.Fatalf("expected a warning as error, got %v", err)
+	}
+
+	// supported images have no warnings
+	_, warnings, err = RenderWithWarnings(context.Background(), strings.NewReader(`<svg viewBox="0 0 10 10"><rect width="5" height="5"/></svg>`), &Options{Strict: true})
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %v (%v)", warnings, err)
+	}
+}
+
+func TestSessionWarn(t *testing.T) {
+	sess := newSession(context.Background(), Limits{})
+	output := newCanvas(0, 0, 10, 10, image.NewRGBA(image.Rect(0, 0, 10, 10)), nil, sess)
+	output.State().SetBlendingMode("multiply")
+	output.State().SetBlendingMode("multiply") // identical warnings are merged
+	output.State().SetBlendingMode("screen")
+	if warnings := sess.getWarnings(); len(warnings) != 2 || warnings[0].Feature != "blend-mode" {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+	if sess.failed() {
+		t.Fatal("warnings should not abort the rendering")
+	}
+
+	sess.strict = true
+	output.State().SetBlendingMode("darken")
+	if !sess.failed() {
+		t.Fatal("warnings should abort the rendering in strict mode")
+	}
+}
+
+func TestElementWarnings(t *testing.T) {
+	// no fonts are configured
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10">
+	<text id="title" y="5">Title</text>
+	<g id="g"><text y="10">Text</text></g>
+	</svg>`
+	_, warnings, err := RenderWithWarnings(context.Background(), strings.NewReader(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []Warning{
+		{Feature: "text", ID: "title", Message: "text is ignored since no fonts are configured"},
+		{Feature: "text", Message: "text is ignored since no fonts are configured"}, // the id is not inherited
+	}
+	if !reflect.DeepEqual(warnings, exp) {
+		t.Fatalf("expected %v, got %v", exp, warnings)
+	}
+
+	sess := newSession(context.Background(), Limits{})
+	output := newCanvas(0, 0, 10, 10, image.NewRGBA(image.Rect(0, 0, 10, 10)), nil, sess)
+	output.OnNewStack(func() {
+		output.State().SetElementID("r")
+		output.State().SetBlendingMode("multiply")
+	})
+	output.State().SetBlendingMode("multiply")
+	if warnings := sess.getWarnings(); len(warnings) != 2 || warnings[0].ID != "r" || warnings[1].ID != "" {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}